@@ -19,15 +19,25 @@ package main
 import (
 	"flag"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	kruisev1alpha1 "github.com/openkruise/kruise/pkg/apis/apps/v1alpha1"
 	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	"github.com/xkcp0324/workload-controller/pkg/config"
 	"github.com/xkcp0324/workload-controller/pkg/controllers"
+	"github.com/xkcp0324/workload-controller/pkg/fieldpath"
+	"github.com/xkcp0324/workload-controller/pkg/healthz"
+	"github.com/xkcp0324/workload-controller/pkg/metrics"
+	"github.com/xkcp0324/workload-controller/pkg/notify"
+	"github.com/xkcp0324/workload-controller/pkg/resources"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	// +kubebuilder:scaffold:imports
 	"k8s.io/klog"
 )
@@ -46,22 +56,142 @@ func init() {
 	// +kubebuilder:scaffold:scheme
 }
 
+// ignoredFieldsFlag collects the repeated --ignore-field flags
+type ignoredFieldsFlag []workloadv1beta1.IgnoredField
+
+func (f *ignoredFieldsFlag) String() string {
+	fields := make([]string, 0, len(*f))
+	for _, ignored := range *f {
+		if ignored.Kind == "" {
+			fields = append(fields, ignored.Path)
+			continue
+		}
+		fields = append(fields, ignored.Kind+":"+ignored.Path)
+	}
+	return strings.Join(fields, ",")
+}
+
+func (f *ignoredFieldsFlag) Set(value string) error {
+	ignored := workloadv1beta1.IgnoredField{Path: value}
+	if i := strings.Index(value, ":"); i > 0 && !strings.ContainsAny(value[:i], ".[") {
+		ignored.Kind, ignored.Path = value[:i], value[i+1:]
+	}
+
+	if _, err := fieldpath.Parse(ignored.Path); err != nil {
+		return err
+	}
+	*f = append(*f, ignored)
+	return nil
+}
+
+// listFlag is a comma separated list, of namespaces or endpoints
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *listFlag) Set(value string) error {
+	*f = strings.Split(value, ",")
+	return nil
+}
+
 func main() {
+	var configFile string
 	var metricsAddr string
+	var healthProbeAddr string
 	var enableLeaderElection bool
+	var leaderElectionNamespace string
+	var leaderElectionID string
+	var leaseDuration time.Duration
+	var renewDeadline time.Duration
+	var retryPeriod time.Duration
+	var enableWebhook bool
+	cfg := config.Default()
 	klog.InitFlags(nil)
+	flag.StringVar(&configFile, "config", "",
+		"The controller configuration file, of kind "+config.Kind+" and apiVersion "+config.APIVersion+
+			". The flags given on the command line override it.")
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+	flag.StringVar(&healthProbeAddr, "health-probe-addr", ":9440",
+		"The address the /healthz and /readyz endpoints bind to, 0 disables them. "+
+			"With leader election enabled only the leader is ready.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&leaderElectionNamespace, "leader-election-namespace", "",
+		"The namespace of the leader election lock, defaults to the namespace the manager runs in.")
+	flag.StringVar(&leaderElectionID, "leader-election-id", "workload-controller-leader-election",
+		"The name of the leader election lock.")
+	flag.DurationVar(&leaseDuration, "leader-election-lease-duration", 15*time.Second,
+		"How long followers wait before trying to acquire a leadership that was not renewed.")
+	flag.DurationVar(&renewDeadline, "leader-election-renew-deadline", 10*time.Second,
+		"How long the leader retries renewing its leadership before giving it up, less than the lease duration.")
+	flag.DurationVar(&retryPeriod, "leader-election-retry-period", 2*time.Second,
+		"How long to wait between tries to acquire or renew the leadership.")
+	flag.BoolVar(&enableWebhook, "enable-webhook", false,
+		"Enable the AdvDeployment defaulting and validating webhooks. Requires the webhook serving certificate. "+
+			"Without them invalid AdvDeployments are still refused by the controller, only later.")
+	flag.IntVar(&cfg.MaxConcurrentReconciles, "max-concurrent-reconciles", cfg.MaxConcurrentReconciles,
+		"The number of AdvDeployments reconciled at once.")
+	flag.DurationVar(&cfg.RequeueInterval.Duration, "requeue-interval", cfg.RequeueInterval.Duration,
+		"How long after a reconcile an AdvDeployment is reconciled again.")
+	flag.StringVar(&cfg.DefaultDomainSuffix, "default-domain-suffix", cfg.DefaultDomainSuffix,
+		"The domain suffix used for AdvDeployments without spec.domain, the domain is <name>.<suffix>.")
+	flag.IntVar(&cfg.ServiceTargetPort, "service-target-port", cfg.ServiceTargetPort,
+		"The container port the Services of the AdvDeployments forward to.")
+	flag.Var((*listFlag)(&cfg.ObservedNamespaces), "observed-namespaces",
+		"The comma separated namespaces the AdvDeployments are reconciled in.")
+	flag.StringVar(&cfg.PrometheusURL, "prometheus-url", cfg.PrometheusURL,
+		"The Prometheus endpoint the metrics of the rollout analyses are measured against, like http://prometheus:9090.")
+	flag.Var((*listFlag)(&cfg.Notifications.Endpoints), "notification-endpoints",
+		"The comma separated URLs notified when a rollout starts, waits for confirmation, completes or fails.")
+	flag.StringVar(&cfg.Notifications.SecretFile, "notification-secret-file", cfg.Notifications.SecretFile,
+		"The file holding the key the notifications are signed with, as the HMAC-SHA256 in the "+notify.SignatureHeader+" header. Required with notification endpoints.")
+	flag.BoolVar(&resources.DryRun, "dry-run", false,
+		"Only report the changes to the resources of every AdvDeployment as events, using server-side dry runs. "+
+			"A single AdvDeployment is dry run with the "+resources.DryRunAnnotation+"=true annotation.")
+	flag.BoolVar(&resources.ServerSideApply, "server-side-apply", false,
+		"Reconcile resources with server-side apply as field manager "+resources.FieldManager+
+			" instead of three-way patches against the last-applied annotation, which is removed from existing resources.")
+	flag.Var((*ignoredFieldsFlag)(&cfg.IgnoredFields), "ignore-field",
+		"A field of child resources left to other managers, as [Kind:]path like Deployment:spec.replicas or "+
+			"spec.template.spec.containers[name=istio-proxy]. May be repeated, adding to those of the configuration file.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.Logger(true))
 
+	if configFile != "" {
+		loaded, err := config.Load(configFile)
+		if err != nil {
+			setupLog.Error(err, "unable to load the controller configuration")
+			os.Exit(1)
+		}
+		// parse again for the flags to override the file
+		*cfg = *loaded
+		flag.Parse()
+	}
+	if err := cfg.Validate(); err != nil {
+		setupLog.Error(err, "invalid controller configuration")
+		os.Exit(1)
+	}
+	cfg.Apply()
+
+	if enableLeaderElection && renewDeadline >= leaseDuration {
+		setupLog.Error(nil, "the leader election renew deadline must be less than the lease duration",
+			"renewDeadline", renewDeadline, "leaseDuration", leaseDuration)
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:             scheme,
-		MetricsBindAddress: "0",
-		LeaderElection:     enableLeaderElection,
-		Port:               9443,
+		Scheme:                  scheme,
+		MetricsBindAddress:      metricsAddr,
+		LeaderElection:          enableLeaderElection,
+		LeaderElectionNamespace: leaderElectionNamespace,
+		LeaderElectionID:        leaderElectionID,
+		LeaseDuration:           &leaseDuration,
+		RenewDeadline:           &renewDeadline,
+		RetryPeriod:             &retryPeriod,
+		Port:                    9443,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
@@ -75,10 +205,55 @@ func main() {
 		os.Exit(1)
 	}
 
+	if enableWebhook {
+		setupLog.Info("Setting up webhook")
+		if err := (&workloadv1beta1.AdvDeployment{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "AdvDeployment")
+			os.Exit(1)
+		}
+	}
+
 	// +kubebuilder:scaffold:builder
 
+	// standby replicas stay ready to serve the webhooks, the leadership is
+	// only exported as a metric
+	_ = mgr.Add(manager.RunnableFunc(func(stop <-chan struct{}) error {
+		metrics.Leader.Set(1)
+		<-stop
+		metrics.Leader.Set(0)
+		return nil
+	}))
+
+	stop := ctrl.SetupSignalHandler()
+	if healthProbeAddr != "0" {
+		probes := healthz.NewServer(healthProbeAddr)
+		probes.AddHealthzCheck("ping", healthz.Ping)
+
+		cacheSynced := healthz.NewFlag("informer caches are not synced")
+		_ = mgr.Add(healthz.SetOnStart(cacheSynced, false))
+		probes.AddReadyzCheck("cache-sync", cacheSynced.Check)
+
+		if enableWebhook {
+			certDir := mgr.GetWebhookServer().CertDir
+			if certDir == "" {
+				certDir = filepath.Join(os.TempDir(), "k8s-webhook-server", "serving-certs")
+			}
+			probes.AddReadyzCheck("webhook-certs", healthz.FilesExist(
+				filepath.Join(certDir, "tls.crt"),
+				filepath.Join(certDir, "tls.key"),
+			))
+		}
+
+		go func() {
+			if err := probes.Start(stop); err != nil {
+				setupLog.Error(err, "problem serving health probes")
+				os.Exit(1)
+			}
+		}()
+	}
+
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	if err := mgr.Start(stop); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
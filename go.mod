@@ -3,7 +3,6 @@ module github.com/xkcp0324/workload-controller
 go 1.12
 
 require (
-	github.com/docker/distribution v2.7.1+incompatible // indirect
 	github.com/emicklei/go-restful v2.10.0+incompatible // indirect
 	github.com/go-logr/logr v0.1.0
 	github.com/go-openapi/spec v0.19.3 // indirect
@@ -11,20 +10,45 @@ require (
 	github.com/goph/emperror v0.17.2
 	github.com/onsi/ginkgo v1.8.0
 	github.com/onsi/gomega v1.5.0
-	github.com/opencontainers/go-digest v1.0.0-rc1 // indirect
 	github.com/openkruise/kruise v0.2.0
 	github.com/pkg/errors v0.8.1
-	k8s.io/api v0.0.0-20190409021203-6e4e0e4f393b
-	k8s.io/apiextensions-apiserver v0.0.0-20190409022649-727a075fdec8
-	k8s.io/apimachinery v0.0.0-20190404173353-6a84e37a896d
-	k8s.io/client-go v11.0.1-0.20190409021438-1a26190bd76a+incompatible
+	github.com/prometheus/client_golang v0.9.2
+	k8s.io/api v0.16.4
+	k8s.io/apiextensions-apiserver v0.16.4
+	k8s.io/apimachinery v0.16.4
+	k8s.io/client-go v0.16.4
 	k8s.io/klog v0.4.0
-	k8s.io/kubernetes v1.14.6
-	sigs.k8s.io/controller-runtime v0.2.2
+	k8s.io/kubernetes v1.16.4 // indirect
+	sigs.k8s.io/controller-runtime v0.4.0
+	sigs.k8s.io/yaml v1.1.0
 )
 
 replace (
-	// Kubernetes 1.14.6
-	k8s.io/kubernetes => k8s.io/kubernetes v1.14.6
-	sigs.k8s.io/controller-runtime => sigs.k8s.io/controller-runtime v0.2.2
+	// Kubernetes 1.16.4, k8s.io/kubernetes requires its staging modules at v0.0.0
+	k8s.io/api => k8s.io/api v0.16.4
+	k8s.io/apiextensions-apiserver => k8s.io/apiextensions-apiserver v0.16.4
+	k8s.io/apimachinery => k8s.io/apimachinery v0.16.4
+	k8s.io/apiserver => k8s.io/apiserver v0.16.4
+	k8s.io/cli-runtime => k8s.io/cli-runtime v0.16.4
+	k8s.io/client-go => k8s.io/client-go v0.16.4
+	k8s.io/cloud-provider => k8s.io/cloud-provider v0.16.4
+	k8s.io/cluster-bootstrap => k8s.io/cluster-bootstrap v0.16.4
+	k8s.io/code-generator => k8s.io/code-generator v0.16.4
+	k8s.io/component-base => k8s.io/component-base v0.16.4
+	k8s.io/cri-api => k8s.io/cri-api v0.16.4
+	k8s.io/csi-translation-lib => k8s.io/csi-translation-lib v0.16.4
+	k8s.io/kube-aggregator => k8s.io/kube-aggregator v0.16.4
+	k8s.io/kube-controller-manager => k8s.io/kube-controller-manager v0.16.4
+	k8s.io/kube-proxy => k8s.io/kube-proxy v0.16.4
+	k8s.io/kube-scheduler => k8s.io/kube-scheduler v0.16.4
+	k8s.io/kubectl => k8s.io/kubectl v0.16.4
+	k8s.io/kubelet => k8s.io/kubelet v0.16.4
+	k8s.io/kubernetes => k8s.io/kubernetes v1.16.4
+	k8s.io/legacy-cloud-providers => k8s.io/legacy-cloud-providers v0.16.4
+	k8s.io/metrics => k8s.io/metrics v0.16.4
+	k8s.io/node-api => k8s.io/node-api v0.16.4
+	k8s.io/sample-apiserver => k8s.io/sample-apiserver v0.16.4
+	k8s.io/sample-cli-plugin => k8s.io/sample-cli-plugin v0.16.4
+	k8s.io/sample-controller => k8s.io/sample-controller v0.16.4
+	sigs.k8s.io/controller-runtime => sigs.k8s.io/controller-runtime v0.4.0
 )
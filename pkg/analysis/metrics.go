@@ -0,0 +1,165 @@
+package analysis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goph/emperror"
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+)
+
+// Prometheus queries a Prometheus-compatible HTTP API
+type Prometheus struct {
+	// URL is the base of the API, without /api/v1
+	URL    string
+	Client *http.Client
+}
+
+// NewPrometheus returns a Prometheus client of the API at url
+func NewPrometheus(url string) *Prometheus {
+	return &Prometheus{
+		URL:    strings.TrimSuffix(url, "/"),
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type queryResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// Query runs the instant query, which must return a single sample
+func (p *Prometheus) Query(ctx context.Context, query string) (float64, error) {
+	req, err := http.NewRequest(http.MethodGet, p.URL+"/api/v1/query?"+url.Values{"query": {query}}.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := p.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, emperror.Wrap(err, "querying Prometheus failed")
+	}
+	defer resp.Body.Close()
+
+	var result queryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, emperror.WrapWith(err, "invalid Prometheus response", "status", resp.StatusCode)
+	}
+	if result.Status != "success" {
+		return 0, fmt.Errorf("query failed with %s: %s", result.ErrorType, result.Error)
+	}
+
+	// a sample is a [timestamp, "value"] pair
+	var sample []interface{}
+	switch result.Data.ResultType {
+	case "scalar":
+		if err := json.Unmarshal(result.Data.Result, &sample); err != nil {
+			return 0, emperror.Wrap(err, "invalid scalar")
+		}
+	case "vector":
+		var vector []struct {
+			Value []interface{} `json:"value"`
+		}
+		if err := json.Unmarshal(result.Data.Result, &vector); err != nil {
+			return 0, emperror.Wrap(err, "invalid vector")
+		}
+		if len(vector) != 1 {
+			return 0, fmt.Errorf("query returned %d samples instead of 1", len(vector))
+		}
+		sample = vector[0].Value
+	default:
+		return 0, fmt.Errorf("query returned a %s instead of a scalar or vector", result.Data.ResultType)
+	}
+
+	if len(sample) != 2 {
+		return 0, fmt.Errorf("invalid sample %v", sample)
+	}
+	value, ok := sample[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("invalid sample value %v", sample[1])
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// QueryArgs are the values available to the queries of the metrics
+type QueryArgs struct {
+	Namespace       string
+	Name            string
+	Deployment      string
+	Revision        string
+	PodTemplateHash string
+}
+
+// Phase is the outcome of a Measurement
+type Phase string
+
+const (
+	// Successful measurements are within the bounds of the metric
+	Successful Phase = "Successful"
+	// Failed measurements are out of the bounds of the metric
+	Failed Phase = "Failed"
+	// Inconclusive measurements could not be taken, Prometheus is missing,
+	// unreachable or the query does not return a single number yet
+	Inconclusive Phase = "Inconclusive"
+)
+
+// Measurement is the outcome of measuring a metric
+type Measurement struct {
+	Phase Phase
+	// Reason tells why the measurement is not successful
+	Reason string
+}
+
+// Measure runs the query of metric and tells whether the value is within
+// its bounds
+func Measure(ctx context.Context, prometheus *Prometheus, metric *workloadv1beta1.MetricAnalysis, args QueryArgs) Measurement {
+	inconclusive := func(err error) Measurement {
+		return Measurement{Phase: Inconclusive, Reason: err.Error()}
+	}
+	if prometheus == nil {
+		return Measurement{Phase: Inconclusive, Reason: "no Prometheus endpoint is configured"}
+	}
+
+	tpl, err := metric.QueryTemplate()
+	if err != nil {
+		return inconclusive(err)
+	}
+	query := &bytes.Buffer{}
+	if err := tpl.Execute(query, args); err != nil {
+		return inconclusive(err)
+	}
+
+	value, err := prometheus.Query(ctx, query.String())
+	if err != nil {
+		return inconclusive(err)
+	}
+	// a ratio without traffic yet is 0/0, which is within any bounds
+	if math.IsNaN(value) {
+		return Measurement{Phase: Inconclusive, Reason: "query returned NaN"}
+	}
+
+	min, max, err := metric.Bounds()
+	if err != nil {
+		return inconclusive(err)
+	}
+	if min != nil && value < *min {
+		return Measurement{Phase: Failed, Reason: fmt.Sprintf("%g is below %s", value, metric.Min)}
+	}
+	if max != nil && value > *max {
+		return Measurement{Phase: Failed, Reason: fmt.Sprintf("%g is above %s", value, metric.Max)}
+	}
+	return Measurement{Phase: Successful}
+}
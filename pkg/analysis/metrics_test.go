@@ -0,0 +1,57 @@
+package analysis
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+)
+
+func TestMeasure(t *testing.T) {
+	responses := map[string]string{
+		`errors{pod=~"app-gz01b-abc-.*"}`: `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1571234567.1,"0.25"]}]}}`,
+		`latency`:                         `{"status":"success","data":{"resultType":"scalar","result":[1571234567.1,"0.1"]}}`,
+		`empty`:                           `{"status":"success","data":{"resultType":"vector","result":[]}}`,
+		`ratio`:                           `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1571234567.1,"NaN"]}]}}`,
+		`invalid(`:                        `{"status":"error","errorType":"bad_data","error":"parse error"}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v1/query" {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write([]byte(responses[req.URL.Query().Get("query")]))
+	}))
+	defer server.Close()
+
+	prometheus := NewPrometheus(server.URL + "/")
+	args := QueryArgs{Namespace: "default", Name: "app", Deployment: "app-gz01b", Revision: "2", PodTemplateHash: "abc"}
+
+	for _, test := range []struct {
+		metric workloadv1beta1.MetricAnalysis
+		phase  Phase
+		reason string
+	}{
+		{workloadv1beta1.MetricAnalysis{Query: `errors{pod=~"{{.Deployment}}-{{.PodTemplateHash}}-.*"}`, Max: "0.5"}, Successful, ""},
+		{workloadv1beta1.MetricAnalysis{Query: `errors{pod=~"{{.Deployment}}-{{.PodTemplateHash}}-.*"}`, Max: "0.1"}, Failed, "0.25 is above 0.1"},
+		{workloadv1beta1.MetricAnalysis{Query: `latency`, Min: "0.2", Max: "1"}, Failed, "0.1 is below 0.2"},
+		{workloadv1beta1.MetricAnalysis{Query: `empty`, Max: "1"}, Inconclusive, "0 samples"},
+		{workloadv1beta1.MetricAnalysis{Query: `ratio`, Min: "0", Max: "1"}, Inconclusive, "NaN"},
+		{workloadv1beta1.MetricAnalysis{Query: `invalid(`, Max: "1"}, Inconclusive, "parse error"},
+		{workloadv1beta1.MetricAnalysis{Query: `{{.Missing}}`, Max: "1"}, Inconclusive, "Missing"},
+	} {
+		test.metric.Name = "test"
+		measurement := Measure(context.TODO(), prometheus, &test.metric, args)
+		if measurement.Phase != test.phase || !strings.Contains(measurement.Reason, test.reason) {
+			t.Errorf("Expected %s to be %s with %q, got %+v", test.metric.Query, test.phase, test.reason, measurement)
+		}
+	}
+
+	measurement := Measure(context.TODO(), nil, &workloadv1beta1.MetricAnalysis{Query: "latency", Max: "1"}, args)
+	if measurement.Phase != Inconclusive {
+		t.Errorf("Expected the measurement to be inconclusive without a Prometheus endpoint, got %+v", measurement)
+	}
+}
@@ -0,0 +1,158 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// forgetAfter is how long the readiness of a pod no longer observed, or the
+// failed measurements of a metric no longer measured, are kept
+const forgetAfter = time.Hour
+
+// PodHealth sums up the health of the pods of a revision
+type PodHealth struct {
+	Pods           int
+	Restarts       int32
+	CrashLoops     int32
+	OOMKills       int32
+	ReadinessFlaps int32
+}
+
+// Exceeded describes the thresholds of analysis the health exceeds, it is
+// empty as long as the pods are healthy
+func (h PodHealth) Exceeded(analysis *workloadv1beta1.RolloutAnalysis) string {
+	var exceeded []string
+	for _, threshold := range []struct {
+		name  string
+		value int32
+		max   *int32
+	}{
+		{"restarts", h.Restarts, analysis.MaxRestarts},
+		{"crash loops", h.CrashLoops, analysis.MaxCrashLoops},
+		{"OOM kills", h.OOMKills, analysis.MaxOOMKills},
+		{"readiness flaps", h.ReadinessFlaps, analysis.MaxReadinessFlaps},
+	} {
+		if threshold.max != nil && threshold.value > *threshold.max {
+			exceeded = append(exceeded, fmt.Sprintf("%d %s exceed %d", threshold.value, threshold.name, *threshold.max))
+		}
+	}
+	return strings.Join(exceeded, ", ")
+}
+
+type podRecord struct {
+	ready    bool
+	flaps    int32
+	lastSeen time.Time
+}
+
+type failureRecord struct {
+	failures int32
+	lastSeen time.Time
+}
+
+// Tracker remembers the readiness of the pods between analyses to count how
+// often they turn unready, and the failed measurements of the metrics. Flaps
+// between two analyses go unnoticed, and the counts start over with a new
+// leader.
+type Tracker struct {
+	mu       sync.Mutex
+	pods     map[types.UID]*podRecord
+	failures map[string]*failureRecord
+}
+
+// NewTracker returns an empty Tracker
+func NewTracker() *Tracker {
+	return &Tracker{
+		pods:     make(map[types.UID]*podRecord),
+		failures: make(map[string]*failureRecord),
+	}
+}
+
+// Observe records the readiness of pods and returns their health
+func (t *Tracker) Observe(pods []corev1.Pod) PodHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	health := PodHealth{Pods: len(pods)}
+	for i := range pods {
+		pod := &pods[i]
+
+		ready := isPodReady(pod)
+		record, ok := t.pods[pod.UID]
+		if !ok {
+			record = &podRecord{ready: ready}
+			t.pods[pod.UID] = record
+		}
+		if record.ready && !ready {
+			record.flaps++
+		}
+		record.ready = ready
+		record.lastSeen = now
+		health.ReadinessFlaps += record.flaps
+
+		for _, status := range pod.Status.ContainerStatuses {
+			health.Restarts += status.RestartCount
+			if status.State.Waiting != nil && status.State.Waiting.Reason == "CrashLoopBackOff" {
+				health.CrashLoops++
+			}
+			if isOOMKilled(status.State.Terminated) || isOOMKilled(status.LastTerminationState.Terminated) {
+				health.OOMKills++
+			}
+		}
+	}
+
+	t.forget(now)
+	return health
+}
+
+// Failed records a failed measurement of the metric identified by key, and
+// returns the number of failed measurements so far
+func (t *Tracker) Failed(key string) int32 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	record, ok := t.failures[key]
+	if !ok {
+		record = &failureRecord{}
+		t.failures[key] = record
+	}
+	record.failures++
+	record.lastSeen = now
+
+	t.forget(now)
+	return record.failures
+}
+
+func (t *Tracker) forget(now time.Time) {
+	for uid, record := range t.pods {
+		if now.Sub(record.lastSeen) > forgetAfter {
+			delete(t.pods, uid)
+		}
+	}
+	for key, record := range t.failures {
+		if now.Sub(record.lastSeen) > forgetAfter {
+			delete(t.failures, key)
+		}
+	}
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func isOOMKilled(terminated *corev1.ContainerStateTerminated) bool {
+	return terminated != nil && terminated.Reason == "OOMKilled"
+}
@@ -0,0 +1,63 @@
+package analysis
+
+import (
+	"testing"
+
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	"github.com/xkcp0324/workload-controller/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func pod(uid string, ready bool, containers ...corev1.ContainerStatus) corev1.Pod {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{UID: types.UID(uid)},
+		Status: corev1.PodStatus{
+			Conditions:        []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+			ContainerStatuses: containers,
+		},
+	}
+}
+
+func TestTrackerObserve(t *testing.T) {
+	tracker := NewTracker()
+
+	crashing := corev1.ContainerStatus{
+		RestartCount: 3,
+		State: corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+		},
+		LastTerminationState: corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled"},
+		},
+	}
+	healthy := corev1.ContainerStatus{RestartCount: 1}
+
+	tracker.Observe([]corev1.Pod{pod("a", true, healthy), pod("b", true, healthy)})
+	tracker.Observe([]corev1.Pod{pod("a", false, healthy), pod("b", true, healthy)})
+	tracker.Observe([]corev1.Pod{pod("a", true, healthy), pod("b", true, healthy)})
+	health := tracker.Observe([]corev1.Pod{pod("a", false, crashing), pod("b", true, healthy)})
+
+	want := PodHealth{Pods: 2, Restarts: 4, CrashLoops: 1, OOMKills: 1, ReadinessFlaps: 2}
+	if health != want {
+		t.Errorf("Expected %+v, got %+v", want, health)
+	}
+
+	analysis := &workloadv1beta1.RolloutAnalysis{
+		MaxRestarts:       utils.IntPointer(5),
+		MaxReadinessFlaps: utils.IntPointer(1),
+	}
+	if exceeded := health.Exceeded(analysis); exceeded != "2 readiness flaps exceed 1" {
+		t.Errorf("Expected only the readiness flaps to exceed their threshold, got %q", exceeded)
+	}
+
+	analysis.MaxReadinessFlaps = nil
+	if exceeded := health.Exceeded(analysis); exceeded != "" {
+		t.Errorf("Expected no threshold to be exceeded, got %q", exceeded)
+	}
+}
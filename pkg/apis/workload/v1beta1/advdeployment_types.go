@@ -18,11 +18,18 @@ package v1beta1
 
 import (
 	"fmt"
+	"github.com/xkcp0324/workload-controller/pkg/fieldpath"
+	"github.com/xkcp0324/workload-controller/pkg/utils"
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/klog"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"time"
 )
 
 // PodUpdateStrategyType is a string enumeration type that enumerates
@@ -42,22 +49,232 @@ type StatefulSetStrategy struct {
 	PodUpdatePolicy PodUpdateStrategyType `json:"podUpdatePolicy,omitempty"`
 }
 
+// DeploymentStrategy is used to communicate parameter for the child Deployments.
+type DeploymentStrategy struct {
+	// RollingUpdate or Recreate, default value is RollingUpdate
+	Type           appsv1.DeploymentStrategyType `json:"type,omitempty"`
+	MaxSurge       *intstr.IntOrString           `json:"maxSurge,omitempty"`
+	MaxUnavailable *intstr.IntOrString           `json:"maxUnavailable,omitempty"`
+}
+
+// The UpgradeTypes of an UpdateStrategy
+const (
+	BetaUpgradeType      = "Beta"
+	BatchUpgradeType     = "Batch"
+	BlueGreenUpgradeType = "BlueGreen"
+	CellUpgradeType      = "Cell"
+)
+
 type UpdateStrategy struct {
-	// Beta, Batch, BlueGreen, Cell
+	// Beta, Batch, BlueGreen, Cell. With Spec.Traffic, Beta sends the first
+	// cell its share of the traffic once it has available pods, and BlueGreen
+	// switches all of it to the last cell once it is rolled out.
 	UpgradeType           string               `json:"upgradeType,omitempty"`
 	BatchSize             *int32               `json:"batchSize,omitempty"`
 	RzNum                 *int32               `json:"rzNum,omitempty"`
 	StatefulSetStrategy   *StatefulSetStrategy `json:"statefulSetStrategy,omitempty"`
+	DeploymentStrategy    *DeploymentStrategy  `json:"deploymentStrategy,omitempty"`
 	Paused                bool                 `json:"paused,omitempty"`
 	NeedWaitingForConfirm bool                 `json:"needWaitingForConfirm,omitempty"`
 	MinReadySeconds       int32                `json:"minReadySeconds,omitempty"`
 	CellReplicas          []*CellReplicas      `json:"cellReplicas,omitempty"`
 	Meta                  map[string]string    `json:"meta,omitempty"`
+	Analysis              *RolloutAnalysis     `json:"analysis,omitempty"`
+}
+
+// RolloutAnalysis watches the pods of the new revision of every Deployment
+// before its rollout completes. Once a threshold is exceeded or a metric fails
+// the rollout is aborted according to the FailurePolicy, the Deployments stay
+// as they are left until their pod template changes again, or until a paused
+// rollout passes the analysis again.
+type RolloutAnalysis struct {
+	// Window is how long the pods are watched once the revision is created,
+	// 5m by default
+	Window *metav1.Duration `json:"window,omitempty"`
+	// MaxRestarts is the number of container restarts allowed across the pods
+	MaxRestarts *int32 `json:"maxRestarts,omitempty"`
+	// MaxCrashLoops is the number of pods allowed in CrashLoopBackOff
+	MaxCrashLoops *int32 `json:"maxCrashLoops,omitempty"`
+	// MaxOOMKills is the number of containers allowed to be OOMKilled
+	MaxOOMKills *int32 `json:"maxOOMKills,omitempty"`
+	// MaxReadinessFlaps is the number of times the pods are allowed to turn
+	// unready after being ready
+	MaxReadinessFlaps *int32 `json:"maxReadinessFlaps,omitempty"`
+	// Metrics are measured against the Prometheus endpoint of the controller
+	// at every reconcile during the window
+	Metrics []MetricAnalysis `json:"metrics,omitempty"`
+	// FailurePolicy is what a failed analysis does to the rollout, Rollback by default
+	FailurePolicy AnalysisFailurePolicy `json:"failurePolicy,omitempty"`
+}
+
+// MetricAnalysis is a PromQL query whose value must stay within Min and Max
+// during the whole analysis window, the rollouts have no steps to scope the
+// bounds to
+type MetricAnalysis struct {
+	// Name identifies the metric in the status and events
+	Name string `json:"name"`
+	// Query is an instant PromQL query returning a single sample. It is a Go
+	// template of .Namespace, .Name of the AdvDeployment, .Deployment,
+	// .Revision and .PodTemplateHash of the revision analyzed, like
+	// sum(rate(http_requests_total{pod=~"{{.Deployment}}-{{.PodTemplateHash}}-.*",code=~"5.."}[1m])).
+	Query string `json:"query"`
+	// Min and Max bound the successful values, as decimal numbers
+	Min string `json:"min,omitempty"`
+	Max string `json:"max,omitempty"`
+	// FailureLimit is the number of failed measurements tolerated, 0 by
+	// default. Inconclusive measurements, without data yet or with Prometheus
+	// unreachable, are not counted, the rollout stays analyzed until the end
+	// of the window.
+	FailureLimit int32 `json:"failureLimit,omitempty"`
+}
+
+// AnalysisFailurePolicy is what a failed RolloutAnalysis does to the rollout
+type AnalysisFailurePolicy string
+
+const (
+	// RollbackAnalysisFailurePolicy rolls the Deployments back to their previous revision. Default.
+	RollbackAnalysisFailurePolicy AnalysisFailurePolicy = "Rollback"
+	// PauseAnalysisFailurePolicy pauses the Deployments where they are, until
+	// the pods are healthy and the metrics successful again.
+	PauseAnalysisFailurePolicy AnalysisFailurePolicy = "Pause"
+)
+
+// DefaultAnalysisWindow is the Window of a RolloutAnalysis without one
+const DefaultAnalysisWindow = 5 * time.Minute
+
+// GetWindow returns the Window or its default
+func (a *RolloutAnalysis) GetWindow() time.Duration {
+	if a.Window == nil {
+		return DefaultAnalysisWindow
+	}
+	return a.Window.Duration
 }
 
 type CellReplicas struct {
 	CellName string `json:"cellName,omitempty"`
 	Replicas int32  `json:"replicas,omitempty"`
+	// Ldc, Group and Zone locate the cell. Without them they are parsed from
+	// CellName as <ldc> or <ldc>-<group>.
+	Ldc   string `json:"ldc,omitempty"`
+	Group string `json:"group,omitempty"`
+	Zone  string `json:"zone,omitempty"`
+	// Labels are merged into the pod template labels of this cell only.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations are merged into the pod template annotations of this cell only.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Template is a strategic merge patch of a PodTemplateSpec applied on top of
+	// Spec.Template for this cell, e.g. nodeSelector, tolerations or resources per ldc.
+	Template *runtime.RawExtension `json:"template,omitempty"`
+	// Weight is the percentage of the traffic routed to this cell when Spec.Traffic is set.
+	// Once a cell has a weight, cells without one get no traffic; when no cell
+	// has a weight, traffic follows the Strategy.UpgradeType.
+	Weight *int32 `json:"weight,omitempty"`
+}
+
+type PodAntiAffinityType string
+
+const (
+	PreferredPodAntiAffinityType PodAntiAffinityType = "Preferred"
+	RequiredPodAntiAffinityType  PodAntiAffinityType = "Required"
+	NonePodAntiAffinityType      PodAntiAffinityType = "None"
+)
+
+// PodAntiAffinityStrategy describes how pods are spread across topology domains.
+// The generated terms are merged into the affinity of the pod template.
+type PodAntiAffinityStrategy struct {
+	// Preferred, Required or None, default value is Preferred
+	Type PodAntiAffinityType `json:"type,omitempty"`
+	// Node label keys to spread on, e.g. kubernetes.io/hostname,
+	// failure-domain.beta.kubernetes.io/zone or sym-ldc.
+	// Default value is kubernetes.io/hostname
+	TopologyKeys []string `json:"topologyKeys,omitempty"`
+	// Weight of the preferred terms, default value is 1
+	Weight int32 `json:"weight,omitempty"`
+	// PerCell spreads the pods of every cell on their own instead of the whole app.
+	PerCell bool `json:"perCell,omitempty"`
+}
+
+// TopologySpreadStrategy describes the topologySpreadConstraints generated
+// for the pods of every cell, next to the ones of the pod template. They need
+// Kubernetes 1.16 or later with the EvenPodsSpread feature gate.
+type TopologySpreadStrategy struct {
+	// Node label keys to spread on, e.g. kubernetes.io/hostname,
+	// failure-domain.beta.kubernetes.io/zone or sym-ldc.
+	// Default value is kubernetes.io/hostname
+	TopologyKeys []string `json:"topologyKeys,omitempty"`
+	// MaxSkew is the difference of pods allowed between two domains, default value is 1
+	MaxSkew int32 `json:"maxSkew,omitempty"`
+	// DoNotSchedule or ScheduleAnyway, default value is ScheduleAnyway
+	WhenUnsatisfiable v1.UnsatisfiableConstraintAction `json:"whenUnsatisfiable,omitempty"`
+}
+
+// IngressStrategy describes the Ingress routing Spec.Domain to the service,
+// <name>.<default domain suffix> without one. Every AdvDeployment has that
+// Ingress unless Disabled.
+type IngressStrategy struct {
+	// Disabled removes the Ingress of the domain
+	Disabled bool `json:"disabled,omitempty"`
+	// Path routed to the service, default value is /
+	Path string `json:"path,omitempty"`
+	// TLSSecretName enables TLS for the domain with the given secret
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+	// IngressClass is set as the kubernetes.io/ingress.class annotation
+	IngressClass string            `json:"ingressClass,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// TrafficStrategy describes the Istio DestinationRule and VirtualService
+// shifting the traffic of the service between cells.
+type TrafficStrategy struct {
+	// Hosts of the VirtualService, default value is the service name
+	Hosts []string `json:"hosts,omitempty"`
+	// Gateways of the VirtualService, default value is the mesh
+	Gateways []string `json:"gateways,omitempty"`
+}
+
+// PodDisruptionBudgetStrategy describes the PodDisruptionBudget protecting the pods.
+// When neither MinAvailable nor MaxUnavailable is set, MaxUnavailable follows
+// the rolling update of the child Deployments.
+type PodDisruptionBudgetStrategy struct {
+	MinAvailable   *intstr.IntOrString `json:"minAvailable,omitempty"`
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	// PerCell creates one PodDisruptionBudget per cell instead of one for the whole app
+	PerCell bool `json:"perCell,omitempty"`
+}
+
+// AutoscalingStrategy describes the HorizontalPodAutoscaler scaling the AdvDeployment.
+// The autoscaled Spec.Replicas are spread across the cells, weighted by the
+// replicas declared for each cell.
+type AutoscalingStrategy struct {
+	MinReplicas                    *int32 `json:"minReplicas,omitempty"`
+	MaxReplicas                    int32  `json:"maxReplicas"`
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+}
+
+// RecreatePolicyType tells how a child resource is replaced when a change to
+// an immutable field, like a selector or the volumeClaimTemplates, keeps it
+// from being updated in place.
+type RecreatePolicyType string
+
+const (
+	// OrphanRecreatePolicy deletes the resource but keeps its pods running
+	// for the new resource to adopt them. Default. It refuses changes to the
+	// selector, which would leave the old pods running unowned.
+	OrphanRecreatePolicy RecreatePolicyType = "Orphan"
+	// DeleteRecreatePolicy deletes the resource along with its pods.
+	DeleteRecreatePolicy RecreatePolicyType = "Delete"
+	// NeverRecreatePolicy fails the reconcile instead.
+	NeverRecreatePolicy RecreatePolicyType = "Never"
+)
+
+// IgnoredField is a field of the child resources of Kind, or of every kind
+// without it, left to other managers like the API server defaults, sidecar
+// injection or an autoscaler. Path is dotted, like spec.replicas, a segment may
+// select list elements like containers[name=istio-proxy] or map keys by prefix
+// like annotations[sidecar.istio.io/*].
+type IgnoredField struct {
+	Kind string `json:"kind,omitempty"`
+	Path string `json:"path"`
 }
 
 type ClusterAllocator struct {
@@ -74,17 +291,26 @@ type ClusterRef struct {
 type AdvDeploymentSpec struct {
 	// support PodSet：InPlaceSet，StatefulSet, deployment
 	// Default value is deployment
-	WorkloadType         string                     `json:"workloadType,omitempty"`
-	RevisionHistoryLimit *int32                     `json:"revisionHistoryLimit,omitempty"`
-	Replicas             *int32                     `json:"replicas,omitempty"`
-	Domain               *string                    `json:"domain,omitempty"`
-	Selector             *metav1.LabelSelector      `json:"selector,omitempty"`
-	Template             v1.PodTemplateSpec         `json:"template"`
-	VolumeClaimTemplates []v1.PersistentVolumeClaim `json:"volumeClaimTemplates,omitempty"`
-	ServiceName          string                     `json:"serviceName,omitempty"`
-	Strategy             UpdateStrategy             `json:"strategy,omitempty"`
-	InstallMultiClusters bool                       `json:"installMultiClusters,omitempty"`
-	ClusterRef           *ClusterRef                `json:"clusterRef,omitempty"`
+	WorkloadType         string                       `json:"workloadType,omitempty"`
+	RevisionHistoryLimit *int32                       `json:"revisionHistoryLimit,omitempty"`
+	Replicas             *int32                       `json:"replicas,omitempty"`
+	Domain               *string                      `json:"domain,omitempty"`
+	Ingress              *IngressStrategy             `json:"ingress,omitempty"`
+	Traffic              *TrafficStrategy             `json:"traffic,omitempty"`
+	PodDisruptionBudget  *PodDisruptionBudgetStrategy `json:"podDisruptionBudget,omitempty"`
+	Autoscaling          *AutoscalingStrategy         `json:"autoscaling,omitempty"`
+	Selector             *metav1.LabelSelector        `json:"selector,omitempty"`
+	Template             v1.PodTemplateSpec           `json:"template"`
+	VolumeClaimTemplates []v1.PersistentVolumeClaim   `json:"volumeClaimTemplates,omitempty"`
+	ServiceName          string                       `json:"serviceName,omitempty"`
+	Strategy             UpdateStrategy               `json:"strategy,omitempty"`
+	PodAntiAffinity      *PodAntiAffinityStrategy     `json:"podAntiAffinity,omitempty"`
+	TopologySpread       *TopologySpreadStrategy      `json:"topologySpread,omitempty"`
+	RecreatePolicy       RecreatePolicyType           `json:"recreatePolicy,omitempty"`
+	IgnoredFields        []IgnoredField               `json:"ignoredFields,omitempty"`
+	LabelKeys            *LabelKeys                   `json:"labelKeys,omitempty"`
+	InstallMultiClusters bool                         `json:"installMultiClusters,omitempty"`
+	ClusterRef           *ClusterRef                  `json:"clusterRef,omitempty"`
 }
 
 type AdvDeploymentConditionType string
@@ -102,6 +328,10 @@ const (
 	// ReplicaFailure is added in a deployment when one of its pods fails to be created
 	// or deleted.
 	DeploymentReplicaFailure AdvDeploymentConditionType = "ReplicaFailure"
+	// RolloutAnalyzed is true once the pods of the new revisions passed the
+	// Strategy.Analysis, unknown while they are watched and false once the
+	// rollout was aborted.
+	RolloutAnalyzed AdvDeploymentConditionType = "RolloutAnalyzed"
 )
 
 // AdvDeploymentCondition describes the state of a adv deployment at a certain point.
@@ -138,20 +368,85 @@ const (
 	Reconciling     DeployState = "Reconciling"
 	Available       DeployState = "Available"
 	Unmanaged       DeployState = "Unmanaged"
+	Terminating     DeployState = "Terminating"
 )
 
+// Finalizer holds an AdvDeployment back until its children have been torn
+// down in every target cluster
+const Finalizer = "workload.dmall.com/finalizer"
+
+// OrphanAnnotation set to "true" on an AdvDeployment releases its children on
+// deletion instead of tearing them down, to roll a migration back
+const OrphanAnnotation = "workload.dmall.com/orphan"
+
+// ManagedByAnnotation marks every child of an AdvDeployment with its
+// namespace/name/uid, the children in member clusters have no owner
+// reference to tell them apart from other workloads sharing the app label
+const ManagedByAnnotation = "workload.dmall.com/managed-by"
+
+// ManagedBy returns the value of the ManagedByAnnotation of the children
+func (in *AdvDeployment) ManagedBy() string {
+	return in.Namespace + "/" + in.Name + "/" + string(in.UID)
+}
+
+// IsManagedBy tells whether obj carries the ManagedByAnnotation of in
+func (in *AdvDeployment) IsManagedBy(obj metav1.Object) bool {
+	return obj.GetAnnotations()[ManagedByAnnotation] == in.ManagedBy()
+}
+
+// TemplateHashAnnotation holds the hash of the desired pod template of a
+// Deployment, which tells the aborted rollouts apart from the ones after a
+// scale or an unrelated change of the spec
+const TemplateHashAnnotation = "workload.dmall.com/template-hash"
+
 // AdvDeploymentStatus defines the observed state of AdvDeployment
 type AdvDeploymentStatus struct {
-	Status        DeployState              `json:"status,omitempty"`
-	Version       string                   `json:"version,omitempty"`
-	Message       string                   `json:"message,omitempty"`
-	Replicas      int32                    `json:"replicas,omitempty" `
-	ReadyReplicas int32                    `json:"readyReplicas,omitempty" `
-	PodSets       map[string]PodSetStatus  `json:"podSets,omitempty"`
-	Conditions    []AdvDeploymentCondition `json:"conditions,omitempty"`
+	ObservedGeneration int64       `json:"observedGeneration,omitempty"`
+	Status             DeployState `json:"status,omitempty"`
+	Version            string      `json:"version,omitempty"`
+	Message            string      `json:"message,omitempty"`
+	Replicas           int32       `json:"replicas,omitempty" `
+	ReadyReplicas      int32       `json:"readyReplicas,omitempty" `
+	// Selector of the pods, used by the scale subresource
+	Selector   string                   `json:"selector,omitempty"`
+	PodSets    map[string]PodSetStatus  `json:"podSets,omitempty"`
+	Conditions []AdvDeploymentCondition `json:"conditions,omitempty"`
+	// AbortedRollouts are the rollouts aborted by the Strategy.Analysis, the
+	// Deployments are kept as the FailurePolicy left them until their pod
+	// template changes again, or until a paused rollout passes again
+	AbortedRollouts []AbortedRollout `json:"abortedRollouts,omitempty"`
+}
+
+// AbortedRollout is the rollout of a pod template to a Deployment aborted by
+// the Strategy.Analysis
+type AbortedRollout struct {
+	// Deployment is the name of the Deployment
+	Deployment string `json:"deployment"`
+	// TemplateHash is the TemplateHashAnnotation of the Deployment whose
+	// rollout was aborted
+	TemplateHash string `json:"templateHash"`
+	// Policy is what the abort does to the Deployment
+	Policy AnalysisFailurePolicy `json:"policy"`
+	// RollbackTo is the pod-template-hash of the ReplicaSet the Deployment is
+	// rolled back to, empty when it is paused or has no previous revision
+	RollbackTo string `json:"rollbackTo,omitempty"`
+}
+
+// GetAbortedRollout returns the aborted rollout of templateHash to the
+// Deployment, nil when it was not aborted
+func (in *AdvDeploymentStatus) GetAbortedRollout(deployment, templateHash string) *AbortedRollout {
+	for i := range in.AbortedRollouts {
+		aborted := &in.AbortedRollouts[i]
+		if aborted.Deployment == deployment && aborted.TemplateHash == templateHash {
+			return aborted
+		}
+	}
+	return nil
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.replicas,selectorpath=.status.selector
 
 // AdvDeployment is the Schema for the advdeployments API
 type AdvDeployment struct {
@@ -183,15 +478,30 @@ func (in *AdvDeployment) Default() {
 		return
 	}
 
+	if !utils.ContainsString(in.Finalizers, Finalizer) {
+		in.Finalizers = append(in.Finalizers, Finalizer)
+	}
+
 	klog.V(4).Info("AdvDeployment: ", in.GetName())
 }
 
+// SetupWebhookWithManager registers the defaulting and validating webhooks
+func (in *AdvDeployment) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(in).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-workload-dmall-com-v1beta1-advdeployment,mutating=true,failurePolicy=fail,groups=workload.dmall.com,resources=advdeployments,verbs=create;update,versions=v1beta1,name=madvdeployment.workload.dmall.com
+// +kubebuilder:webhook:path=/validate-workload-dmall-com-v1beta1-advdeployment,mutating=false,failurePolicy=fail,groups=workload.dmall.com,resources=advdeployments,verbs=create;update,versions=v1beta1,name=vadvdeployment.workload.dmall.com
+
 // ValidateCreate implements webhook.Validator
 // 1. check filed regex
+// 2. check cell template overlays
 func (in *AdvDeployment) ValidateCreate() error {
 	klog.V(4).Info("validate AdvDeployment create: ", in.GetName())
 
-	return nil
+	return in.validate()
 }
 
 // ValidateUpdate validate HelmRequest update request
@@ -204,6 +514,171 @@ func (in *AdvDeployment) ValidateUpdate(old runtime.Object) error {
 	if !ok {
 		return fmt.Errorf("expect old object to be a %T instead of %T", oldHR, old)
 	}
+	// the finalizer must come off even if the controller configuration
+	// changed what is valid meanwhile
+	if in.DeletionTimestamp != nil {
+		return nil
+	}
 
+	return in.validate()
+}
+
+// ValidateDelete implements webhook.Validator, nothing to check on delete
+func (in *AdvDeployment) ValidateDelete() error {
 	return nil
 }
+
+// Validate checks the AdvDeployment as the validating webhook does, for the
+// controller to refuse invalid ones when the webhook is not installed
+func (in *AdvDeployment) Validate() error {
+	return in.validate()
+}
+
+func (in *AdvDeployment) validate() error {
+	var allErrs field.ErrorList
+
+	if ds := in.Spec.Strategy.DeploymentStrategy; ds != nil {
+		dsPath := field.NewPath("spec", "strategy", "deploymentStrategy")
+		switch ds.Type {
+		case "", appsv1.RollingUpdateDeploymentStrategyType:
+		case appsv1.RecreateDeploymentStrategyType:
+			if ds.MaxSurge != nil || ds.MaxUnavailable != nil {
+				allErrs = append(allErrs, field.Forbidden(dsPath, "maxSurge and maxUnavailable may not be specified when type is Recreate"))
+			}
+		default:
+			allErrs = append(allErrs, field.NotSupported(dsPath.Child("type"), ds.Type,
+				[]string{string(appsv1.RollingUpdateDeploymentStrategyType), string(appsv1.RecreateDeploymentStrategyType)}))
+		}
+	}
+
+	switch in.Spec.RecreatePolicy {
+	case "", OrphanRecreatePolicy, DeleteRecreatePolicy, NeverRecreatePolicy:
+	default:
+		allErrs = append(allErrs, field.NotSupported(field.NewPath("spec", "recreatePolicy"), in.Spec.RecreatePolicy,
+			[]string{string(OrphanRecreatePolicy), string(DeleteRecreatePolicy), string(NeverRecreatePolicy)}))
+	}
+
+	if in.Spec.LabelKeys != nil {
+		// the keys set must not clash with the defaults of the others either
+		allErrs = append(allErrs, in.GetLabelKeys().Validate(field.NewPath("spec", "labelKeys"), true)...)
+	}
+
+	for i, ignored := range in.Spec.IgnoredFields {
+		if _, err := fieldpath.Parse(ignored.Path); err != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "ignoredFields").Index(i).Child("path"), ignored.Path, err.Error()))
+		}
+	}
+
+	if aa := in.Spec.PodAntiAffinity; aa != nil {
+		aaPath := field.NewPath("spec", "podAntiAffinity")
+		switch aa.Type {
+		case "", PreferredPodAntiAffinityType, RequiredPodAntiAffinityType, NonePodAntiAffinityType:
+		default:
+			allErrs = append(allErrs, field.NotSupported(aaPath.Child("type"), aa.Type,
+				[]string{string(PreferredPodAntiAffinityType), string(RequiredPodAntiAffinityType), string(NonePodAntiAffinityType)}))
+		}
+		if aa.Weight < 0 || aa.Weight > 100 {
+			allErrs = append(allErrs, field.Invalid(aaPath.Child("weight"), aa.Weight, "must be in the range 1-100"))
+		}
+	}
+
+	if ts := in.Spec.TopologySpread; ts != nil {
+		tsPath := field.NewPath("spec", "topologySpread")
+		if ts.MaxSkew < 0 {
+			allErrs = append(allErrs, field.Invalid(tsPath.Child("maxSkew"), ts.MaxSkew, "must be greater than or equal to 1"))
+		}
+		switch ts.WhenUnsatisfiable {
+		case "", v1.DoNotSchedule, v1.ScheduleAnyway:
+		default:
+			allErrs = append(allErrs, field.NotSupported(tsPath.Child("whenUnsatisfiable"), ts.WhenUnsatisfiable,
+				[]string{string(v1.DoNotSchedule), string(v1.ScheduleAnyway)}))
+		}
+	}
+
+	if as := in.Spec.Autoscaling; as != nil {
+		asPath := field.NewPath("spec", "autoscaling")
+		if as.MaxReplicas < 1 {
+			allErrs = append(allErrs, field.Invalid(asPath.Child("maxReplicas"), as.MaxReplicas, "must be greater than or equal to 1"))
+		}
+		if as.MinReplicas != nil && (*as.MinReplicas < 1 || *as.MinReplicas > as.MaxReplicas) {
+			allErrs = append(allErrs, field.Invalid(asPath.Child("minReplicas"), *as.MinReplicas, "must be between 1 and maxReplicas"))
+		}
+	}
+
+	if analysis := in.Spec.Strategy.Analysis; analysis != nil {
+		analysisPath := field.NewPath("spec", "strategy", "analysis")
+		if analysis.Window != nil && analysis.Window.Duration <= 0 {
+			allErrs = append(allErrs, field.Invalid(analysisPath.Child("window"), analysis.Window.Duration.String(), "must be greater than 0"))
+		}
+		for _, threshold := range []struct {
+			name  string
+			value *int32
+		}{
+			{"maxRestarts", analysis.MaxRestarts},
+			{"maxCrashLoops", analysis.MaxCrashLoops},
+			{"maxOOMKills", analysis.MaxOOMKills},
+			{"maxReadinessFlaps", analysis.MaxReadinessFlaps},
+		} {
+			if threshold.value != nil && *threshold.value < 0 {
+				allErrs = append(allErrs, field.Invalid(analysisPath.Child(threshold.name), *threshold.value, "must be greater than or equal to 0"))
+			}
+		}
+
+		switch analysis.FailurePolicy {
+		case "", RollbackAnalysisFailurePolicy, PauseAnalysisFailurePolicy:
+		default:
+			allErrs = append(allErrs, field.NotSupported(analysisPath.Child("failurePolicy"), analysis.FailurePolicy,
+				[]string{string(RollbackAnalysisFailurePolicy), string(PauseAnalysisFailurePolicy)}))
+		}
+
+		if len(analysis.Metrics) > 0 && !MetricAnalysisEnabled {
+			allErrs = append(allErrs, field.Forbidden(analysisPath.Child("metrics"), "the controller has no Prometheus endpoint configured"))
+		}
+		names := make(map[string]bool, len(analysis.Metrics))
+		for i, metric := range analysis.Metrics {
+			allErrs = append(allErrs, metric.validate(analysisPath.Child("metrics").Index(i))...)
+			if names[metric.Name] {
+				allErrs = append(allErrs, field.Duplicate(analysisPath.Child("metrics").Index(i).Child("name"), metric.Name))
+			}
+			names[metric.Name] = true
+		}
+	}
+
+	if pdb := in.Spec.PodDisruptionBudget; pdb != nil && pdb.MinAvailable != nil && pdb.MaxUnavailable != nil {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "podDisruptionBudget"), "minAvailable and maxUnavailable are mutually exclusive"))
+	}
+
+	cellsPath := field.NewPath("spec", "strategy", "cellReplicas")
+	var weighted bool
+	var totalWeight int32
+	for i, cell := range in.Spec.Strategy.CellReplicas {
+		if cell == nil {
+			allErrs = append(allErrs, field.Required(cellsPath.Index(i), ""))
+			continue
+		}
+
+		if cell.Weight != nil {
+			if *cell.Weight < 0 || *cell.Weight > 100 {
+				allErrs = append(allErrs, field.Invalid(cellsPath.Index(i).Child("weight"), *cell.Weight, "must be in the range 0-100"))
+			}
+			weighted = true
+			totalWeight += *cell.Weight
+		}
+
+		allErrs = append(allErrs, cell.validateIdentity(cellsPath.Index(i))...)
+
+		if _, err := cell.MergePodTemplate(&in.Spec.Template); err != nil {
+			allErrs = append(allErrs, field.Invalid(cellsPath.Index(i).Child("template"), cell.CellName, err.Error()))
+		}
+	}
+
+	if weighted && totalWeight != 100 {
+		allErrs = append(allErrs, field.Invalid(cellsPath, totalWeight, "the weights of the cells must add up to 100"))
+	}
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("AdvDeployment").GroupKind(), in.Name, allErrs)
+}
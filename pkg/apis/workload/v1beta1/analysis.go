@@ -0,0 +1,93 @@
+/*
+Copyright 2019 The dks authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+	"strconv"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// MetricAnalysisEnabled tells whether the controller has a Prometheus endpoint
+// to measure the Metrics of a RolloutAnalysis against, AdvDeployments with
+// Metrics are rejected without one
+var MetricAnalysisEnabled bool
+
+// GetFailurePolicy returns the FailurePolicy or its default
+func (a *RolloutAnalysis) GetFailurePolicy() AnalysisFailurePolicy {
+	if a.FailurePolicy == "" {
+		return RollbackAnalysisFailurePolicy
+	}
+	return a.FailurePolicy
+}
+
+// QueryTemplate parses the Query
+func (m *MetricAnalysis) QueryTemplate() (*template.Template, error) {
+	return template.New(m.Name).Option("missingkey=error").Parse(m.Query)
+}
+
+// Bounds returns Min and Max, nil when unset
+func (m *MetricAnalysis) Bounds() (min, max *float64, err error) {
+	parse := func(name, value string) (*float64, error) {
+		if value == "" {
+			return nil, nil
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s %q is not a decimal number", name, value)
+		}
+		return &f, nil
+	}
+
+	if min, err = parse("min", m.Min); err != nil {
+		return nil, nil, err
+	}
+	if max, err = parse("max", m.Max); err != nil {
+		return nil, nil, err
+	}
+	return min, max, nil
+}
+
+func (m *MetricAnalysis) validate(fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if m.Name == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("name"), ""))
+	}
+	if m.Query == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("query"), ""))
+	} else if _, err := m.QueryTemplate(); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("query"), m.Query, err.Error()))
+	}
+
+	min, max, err := m.Bounds()
+	switch {
+	case err != nil:
+		allErrs = append(allErrs, field.Invalid(fldPath, m.Min+".."+m.Max, err.Error()))
+	case min == nil && max == nil:
+		allErrs = append(allErrs, field.Required(fldPath.Child("max"), "min or max must be set"))
+	case min != nil && max != nil && *min > *max:
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("min"), m.Min, "must not be greater than max"))
+	}
+
+	if m.FailureLimit < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("failureLimit"), m.FailureLimit, "must be greater than or equal to 0"))
+	}
+	return allErrs
+}
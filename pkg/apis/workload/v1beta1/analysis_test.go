@@ -0,0 +1,26 @@
+package v1beta1
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateMetricsNeedPrometheus(t *testing.T) {
+	defer func(enabled bool) { MetricAnalysisEnabled = enabled }(MetricAnalysisEnabled)
+
+	advDeploy := &AdvDeployment{}
+	advDeploy.Spec.Strategy.Analysis = &RolloutAnalysis{
+		Metrics: []MetricAnalysis{{Name: "errors", Query: "errors", Max: "0"}},
+	}
+
+	MetricAnalysisEnabled = false
+	err := advDeploy.ValidateCreate()
+	if err == nil || !strings.Contains(err.Error(), "analysis.metrics") {
+		t.Errorf("Expected the metrics to be rejected without Prometheus, got %v", err)
+	}
+
+	MetricAnalysisEnabled = true
+	if err := advDeploy.ValidateCreate(); err != nil {
+		t.Errorf("Expected the metrics to be accepted with Prometheus, got %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2019 The dks authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// MergePodTemplate returns the pod template of this cell, which is base with
+// the cell Template overlay, Labels and Annotations applied on top of it.
+// base is never modified.
+func (c *CellReplicas) MergePodTemplate(base *v1.PodTemplateSpec) (*v1.PodTemplateSpec, error) {
+	tpl := base.DeepCopy()
+
+	if c.Template != nil && len(c.Template.Raw) > 0 {
+		original, err := json.Marshal(tpl)
+		if err != nil {
+			return nil, err
+		}
+
+		merged, err := strategicpatch.StrategicMergePatch(original, c.Template.Raw, v1.PodTemplateSpec{})
+		if err != nil {
+			return nil, fmt.Errorf("invalid template overlay: %v", err)
+		}
+
+		// unknown fields are most likely typos in the overlay, reject them
+		// instead of dropping them silently
+		decoder := json.NewDecoder(bytes.NewReader(merged))
+		decoder.DisallowUnknownFields()
+		tpl = &v1.PodTemplateSpec{}
+		if err := decoder.Decode(tpl); err != nil {
+			return nil, fmt.Errorf("invalid template overlay: %v", err)
+		}
+	}
+
+	if len(c.Labels) > 0 {
+		if tpl.Labels == nil {
+			tpl.Labels = make(map[string]string, len(c.Labels))
+		}
+		for k, v := range c.Labels {
+			tpl.Labels[k] = v
+		}
+	}
+
+	if len(c.Annotations) > 0 {
+		if tpl.Annotations == nil {
+			tpl.Annotations = make(map[string]string, len(c.Annotations))
+		}
+		for k, v := range c.Annotations {
+			tpl.Annotations[k] = v
+		}
+	}
+
+	return tpl, nil
+}
+
+// CellIdentity locates a cell
+// +kubebuilder:object:generate=false
+type CellIdentity struct {
+	Ldc   string
+	Group string
+	Zone  string
+}
+
+// Identity returns the location of the cell, Ldc, Group and Zone when set,
+// parsed from CellName otherwise
+func (c *CellReplicas) Identity() (CellIdentity, error) {
+	if c.Ldc != "" || c.Group != "" || c.Zone != "" {
+		if c.Ldc == "" {
+			return CellIdentity{}, fmt.Errorf("ldc is required along with group and zone")
+		}
+		return CellIdentity{Ldc: c.Ldc, Group: c.Group, Zone: c.Zone}, nil
+	}
+
+	ldc, group, err := splitCellName(c.CellName)
+	if err != nil {
+		return CellIdentity{}, fmt.Errorf("cell name %q is neither <ldc> nor <ldc>-<group>, set ldc, group and zone instead", c.CellName)
+	}
+	return CellIdentity{Ldc: ldc, Group: group}, nil
+}
+
+// validateIdentity checks the cell has an identity usable as label values
+func (c *CellReplicas) validateIdentity(fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	id, err := c.Identity()
+	if err != nil {
+		if c.Ldc == "" && c.Group == "" && c.Zone == "" {
+			return append(allErrs, field.Invalid(fldPath.Child("cellName"), c.CellName, err.Error()))
+		}
+		return append(allErrs, field.Required(fldPath.Child("ldc"), err.Error()))
+	}
+
+	for _, value := range []struct{ name, value string }{
+		{"ldc", id.Ldc},
+		{"group", id.Group},
+		{"zone", id.Zone},
+	} {
+		for _, msg := range validation.IsValidLabelValue(value.value) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child(value.name), value.value, msg))
+		}
+	}
+	return allErrs
+}
+
+// splitCellName parses a cell name of the form <ldc> or <ldc>-<group>
+func splitCellName(name string) (ldc, group string, err error) {
+	parts := strings.Split(name, "-")
+	switch len(parts) {
+	case 1:
+		return parts[0], "", nil
+	case 2:
+		return parts[0], parts[1], nil
+	}
+	return "", "", fmt.Errorf("unexpected cell name format: %q", name)
+}
@@ -0,0 +1,110 @@
+package v1beta1
+
+import (
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestMergePodTemplate(t *testing.T) {
+	base := &v1.PodTemplateSpec{
+		Spec: v1.PodSpec{
+			NodeSelector: map[string]string{"pool": "default"},
+			Containers: []v1.Container{
+				{Name: "app", Image: "registry-a/app:v1"},
+				{Name: "sidecar", Image: "registry-a/sidecar:v1"},
+			},
+		},
+	}
+	cell := &CellReplicas{
+		CellName: "gz01a",
+		Labels:   map[string]string{"zone": "gz01a"},
+		Template: &runtime.RawExtension{
+			Raw: []byte(`{"spec":{"nodeSelector":{"pool":"gz01a"},"containers":[{"name":"app","image":"registry-b/app:v1"}]}}`),
+		},
+	}
+
+	tpl, err := cell.MergePodTemplate(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tpl.Spec.NodeSelector["pool"] != "gz01a" {
+		t.Fatalf("Expected nodeSelector pool gz01a got %s", tpl.Spec.NodeSelector["pool"])
+	}
+	if len(tpl.Spec.Containers) != 2 || tpl.Spec.Containers[0].Image != "registry-b/app:v1" {
+		t.Fatalf("Expected containers merged by name got %v", tpl.Spec.Containers)
+	}
+	if tpl.Labels["zone"] != "gz01a" {
+		t.Fatalf("Expected label zone gz01a got %v", tpl.Labels)
+	}
+	if base.Spec.NodeSelector["pool"] != "default" {
+		t.Fatal("Expected base template to be untouched")
+	}
+}
+
+func TestMergePodTemplateRejectsUnknownFields(t *testing.T) {
+	cell := &CellReplicas{
+		Template: &runtime.RawExtension{
+			Raw: []byte(`{"spec":{"nodeSelectr":{"pool":"gz01a"}}}`),
+		},
+	}
+
+	if _, err := cell.MergePodTemplate(&v1.PodTemplateSpec{}); err == nil {
+		t.Fatal("Expected an error for unknown field nodeSelectr")
+	}
+}
+
+func TestCellIdentity(t *testing.T) {
+	cases := []struct {
+		cell    CellReplicas
+		want    CellIdentity
+		wantErr bool
+	}{
+		{cell: CellReplicas{CellName: "gz01b"}, want: CellIdentity{Ldc: "gz01b"}},
+		{cell: CellReplicas{CellName: "gz01b-blue"}, want: CellIdentity{Ldc: "gz01b", Group: "blue"}},
+		{cell: CellReplicas{CellName: "gz01b-blue-2"}, wantErr: true},
+		{
+			cell: CellReplicas{CellName: "gz01b-blue-2", Ldc: "gz01b", Group: "blue", Zone: "2"},
+			want: CellIdentity{Ldc: "gz01b", Group: "blue", Zone: "2"},
+		},
+		{cell: CellReplicas{CellName: "gz01b-blue", Group: "blue"}, wantErr: true},
+	}
+
+	for _, c := range cases {
+		id, err := c.cell.Identity()
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("Expected cell %+v to have no identity, got %+v", c.cell, id)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Expected cell %+v to have an identity, got %v", c.cell, err)
+			continue
+		}
+		if id != c.want {
+			t.Errorf("Expected cell %s to be %+v, got %+v", c.cell.CellName, c.want, id)
+		}
+	}
+}
+
+func TestValidateCellIdentity(t *testing.T) {
+	advDeploy := &AdvDeployment{}
+	advDeploy.Spec.Strategy.CellReplicas = []*CellReplicas{
+		{CellName: "gz01b-blue-2"},
+		{CellName: "gz01b-green", Ldc: "gz01b", Group: "green!"},
+		nil,
+	}
+
+	err := advDeploy.ValidateCreate()
+	if err == nil {
+		t.Fatal("Expected the cells to be rejected")
+	}
+	for _, path := range []string{"cellReplicas[0].cellName", "cellReplicas[1].group", "cellReplicas[2]: Required"} {
+		if !strings.Contains(err.Error(), path) {
+			t.Errorf("Expected %s to be rejected, got %v", path, err)
+		}
+	}
+}
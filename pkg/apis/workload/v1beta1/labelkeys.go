@@ -0,0 +1,121 @@
+/*
+Copyright 2019 The dks authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// LabelKeys are the keys of the labels identifying the resources of an
+// AdvDeployment and their cells. Empty keys fall back to the controller ones.
+// Changing the keys of an existing AdvDeployment changes the selectors of its
+// Deployments, which are only re-created with the Delete RecreatePolicy.
+type LabelKeys struct {
+	// Cluster marks the pods of the applications the controller observes
+	Cluster string `json:"cluster,omitempty"`
+	// App holds the name of the AdvDeployment
+	App string `json:"app,omitempty"`
+	// Release holds <name>-<cell> and selects the pods of a cell
+	Release string `json:"release,omitempty"`
+	// Ldc holds the LDC of a cell
+	Ldc string `json:"ldc,omitempty"`
+	// Group holds the group of a cell
+	Group string `json:"group,omitempty"`
+	// Zone holds the zone of a cell, only set on the cells with one
+	Zone string `json:"zone,omitempty"`
+	// LightningDomain holds the domain of the AdvDeployment on its Service
+	LightningDomain string `json:"lightningDomain,omitempty"`
+}
+
+// DefaultLabelKeys are the keys of the controller, used for the keys an
+// AdvDeployment does not set
+var DefaultLabelKeys = LabelKeys{
+	Cluster:         "sym-cluster-info",
+	App:             "app",
+	Release:         "release",
+	Ldc:             "sym-ldc",
+	Group:           "sym-group",
+	Zone:            "sym-zone",
+	LightningDomain: "lightningDomain0",
+}
+
+// Merge returns the keys with those set in override replacing them
+func (k LabelKeys) Merge(override *LabelKeys) LabelKeys {
+	if override == nil {
+		return k
+	}
+
+	merged := k
+	for _, key := range []struct {
+		to   *string
+		from string
+	}{
+		{&merged.Cluster, override.Cluster},
+		{&merged.App, override.App},
+		{&merged.Release, override.Release},
+		{&merged.Ldc, override.Ldc},
+		{&merged.Group, override.Group},
+		{&merged.Zone, override.Zone},
+		{&merged.LightningDomain, override.LightningDomain},
+	} {
+		if key.from != "" {
+			*key.to = key.from
+		}
+	}
+	return merged
+}
+
+// Validate checks the keys set are label keys, and that no two of them are
+// the same. With complete every key must be set.
+func (k LabelKeys) Validate(fldPath *field.Path, complete bool) field.ErrorList {
+	var allErrs field.ErrorList
+
+	seen := make(map[string]string)
+	for _, key := range []struct{ name, value string }{
+		{"cluster", k.Cluster},
+		{"app", k.App},
+		{"release", k.Release},
+		{"ldc", k.Ldc},
+		{"group", k.Group},
+		{"zone", k.Zone},
+		{"lightningDomain", k.LightningDomain},
+	} {
+		keyPath := fldPath.Child(key.name)
+		if key.value == "" {
+			if complete {
+				allErrs = append(allErrs, field.Required(keyPath, ""))
+			}
+			continue
+		}
+
+		for _, msg := range validation.IsQualifiedName(key.value) {
+			allErrs = append(allErrs, field.Invalid(keyPath, key.value, msg))
+		}
+		if other, ok := seen[key.value]; ok {
+			allErrs = append(allErrs, field.Duplicate(keyPath, key.value+" is also the "+other+" key"))
+		}
+		seen[key.value] = key.name
+	}
+	return allErrs
+}
+
+// GetLabelKeys returns the label keys of the AdvDeployment, Spec.LabelKeys
+// over DefaultLabelKeys
+func (in *AdvDeployment) GetLabelKeys() LabelKeys {
+	return DefaultLabelKeys.Merge(in.Spec.LabelKeys)
+}
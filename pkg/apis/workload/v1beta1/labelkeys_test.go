@@ -0,0 +1,36 @@
+package v1beta1
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestGetLabelKeys(t *testing.T) {
+	advDeploy := &AdvDeployment{}
+	if keys := advDeploy.GetLabelKeys(); keys != DefaultLabelKeys {
+		t.Errorf("Expected the default keys, got %+v", keys)
+	}
+
+	advDeploy.Spec.LabelKeys = &LabelKeys{Ldc: "example.com/ldc"}
+	keys := advDeploy.GetLabelKeys()
+	if keys.Ldc != "example.com/ldc" || keys.App != DefaultLabelKeys.App {
+		t.Errorf("Expected the ldc key to be overridden and the others to be the defaults, got %+v", keys)
+	}
+}
+
+func TestValidateLabelKeys(t *testing.T) {
+	path := field.NewPath("labelKeys")
+	if errs := (LabelKeys{App: "example.com/app"}).Validate(path, false); len(errs) != 0 {
+		t.Errorf("Expected a partial set of keys to be valid, got %v", errs)
+	}
+	if errs := (LabelKeys{App: "example.com/app"}).Validate(path, true); len(errs) != 6 {
+		t.Errorf("Expected the 6 missing keys to be required, got %v", errs)
+	}
+	if errs := DefaultLabelKeys.Merge(&LabelKeys{Group: "not a key"}).Validate(path, true); len(errs) != 1 {
+		t.Errorf("Expected the invalid group key to be rejected, got %v", errs)
+	}
+	if errs := DefaultLabelKeys.Merge(&LabelKeys{Release: DefaultLabelKeys.App}).Validate(path, true); len(errs) != 1 {
+		t.Errorf("Expected the release key shared with the app to be rejected, got %v", errs)
+	}
+}
@@ -0,0 +1,62 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/goph/emperror"
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Clients returns a client for every member cluster an AdvDeployment is
+// installed to, keyed by cluster allocator name. The ConfigMap key referenced
+// by Spec.ClusterRef holds a kubeconfig with one context per allocator.
+func Clients(ctx context.Context, c client.Client, scheme *runtime.Scheme, advDeploy *workloadv1beta1.AdvDeployment) (map[string]client.Client, error) {
+	ref := advDeploy.Spec.ClusterRef
+	if !advDeploy.Spec.InstallMultiClusters || ref == nil || len(ref.ClusterAllocators) == 0 {
+		return nil, nil
+	}
+	if ref.ClusterInfoRef == nil {
+		return nil, fmt.Errorf("clusterRef of %s/%s has no configMapKeyRef", advDeploy.Namespace, advDeploy.Name)
+	}
+
+	cm := &corev1.ConfigMap{}
+	key := types.NamespacedName{Namespace: advDeploy.Namespace, Name: ref.ClusterInfoRef.Name}
+	err := c.Get(ctx, key, cm)
+	if err != nil {
+		return nil, emperror.WrapWith(err, "failed to get cluster info", "configmap", key)
+	}
+
+	data, ok := cm.Data[ref.ClusterInfoRef.Key]
+	if !ok {
+		return nil, fmt.Errorf("configmap %s has no key %s", key, ref.ClusterInfoRef.Key)
+	}
+
+	kubeconfig, err := clientcmd.Load([]byte(data))
+	if err != nil {
+		return nil, emperror.WrapWith(err, "failed to load kubeconfig", "configmap", key)
+	}
+
+	clients := make(map[string]client.Client, len(ref.ClusterAllocators))
+	for _, alloc := range ref.ClusterAllocators {
+		if alloc == nil {
+			continue
+		}
+
+		cfg, err := clientcmd.NewNonInteractiveClientConfig(*kubeconfig, alloc.Name, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+		if err != nil {
+			return nil, emperror.WrapWith(err, "failed to build cluster config", "cluster", alloc.Name)
+		}
+
+		clients[alloc.Name], err = client.New(cfg, client.Options{Scheme: scheme})
+		if err != nil {
+			return nil, emperror.WrapWith(err, "failed to create cluster client", "cluster", alloc.Name)
+		}
+	}
+	return clients, nil
+}
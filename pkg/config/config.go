@@ -0,0 +1,213 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/goph/emperror"
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	"github.com/xkcp0324/workload-controller/pkg/controllers/workload"
+	"github.com/xkcp0324/workload-controller/pkg/fieldpath"
+	"github.com/xkcp0324/workload-controller/pkg/notify"
+	"github.com/xkcp0324/workload-controller/pkg/resources"
+	"github.com/xkcp0324/workload-controller/pkg/resources/svc"
+	"github.com/xkcp0324/workload-controller/pkg/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// APIVersion is the version of the configuration file format
+	APIVersion = "config.workload.dmall.com/v1beta1"
+	// Kind is the kind of the configuration file
+	Kind = "ControllerConfiguration"
+)
+
+// ControllerConfiguration holds the tunables of the controller, read from the
+// file given with --config. The fields missing from the file keep their
+// defaults.
+type ControllerConfiguration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// MaxConcurrentReconciles is the number of AdvDeployments reconciled at once
+	MaxConcurrentReconciles int `json:"maxConcurrentReconciles,omitempty"`
+	// RequeueInterval is how long after a reconcile an AdvDeployment is
+	// reconciled again
+	RequeueInterval metav1.Duration `json:"requeueInterval,omitempty"`
+	// DefaultDomainSuffix is used for the AdvDeployments without spec.domain,
+	// their domain is <name>.<suffix>
+	DefaultDomainSuffix string `json:"defaultDomainSuffix,omitempty"`
+	// ServiceTargetPort is the container port the Services forward to
+	ServiceTargetPort int `json:"serviceTargetPort,omitempty"`
+	// ObservedNamespaces are the namespaces the AdvDeployments are reconciled in
+	ObservedNamespaces []string `json:"observedNamespaces,omitempty"`
+	// PrometheusURL is the Prometheus endpoint the metrics of the rollout
+	// analyses are measured against
+	PrometheusURL string `json:"prometheusURL,omitempty"`
+	// Notifications configures the webhooks notified of the rollout milestones
+	Notifications NotificationConfiguration `json:"notifications,omitempty"`
+	// LabelKeys are the keys of the labels identifying the resources of an
+	// AdvDeployment
+	LabelKeys workloadv1beta1.LabelKeys `json:"labelKeys,omitempty"`
+	// IgnoredFields of the child resources are left to other managers for
+	// every AdvDeployment
+	IgnoredFields []workloadv1beta1.IgnoredField `json:"ignoredFields,omitempty"`
+}
+
+// NotificationConfiguration configures the webhooks notified when a rollout
+// starts, waits for confirmation, completes or fails
+type NotificationConfiguration struct {
+	// Endpoints are the URLs the JSON payloads are posted to
+	Endpoints []string `json:"endpoints,omitempty"`
+	// SecretFile holds the key the payloads are signed with, as the
+	// HMAC-SHA256 in the X-Workload-Signature header. It is required with
+	// endpoints.
+	SecretFile string `json:"secretFile,omitempty"`
+	// MaxAttempts is the number of times a payload is posted to an endpoint
+	// before it is dropped
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// Backoff is the wait before the first retry, doubled at every retry
+	Backoff metav1.Duration `json:"backoff,omitempty"`
+}
+
+// Default returns the configuration compiled in, used without a configuration
+// file
+func Default() *ControllerConfiguration {
+	return &ControllerConfiguration{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: APIVersion,
+			Kind:       Kind,
+		},
+		MaxConcurrentReconciles: workload.MaxConcurrentReconciles,
+		RequeueInterval:         metav1.Duration{Duration: workload.RequeueInterval},
+		DefaultDomainSuffix:     resources.DefaultDomainSuffix,
+		ServiceTargetPort:       svc.TargetPort,
+		ObservedNamespaces:      append([]string(nil), utils.ObservedNamespace...),
+		PrometheusURL:           workload.PrometheusURL,
+		Notifications: NotificationConfiguration{
+			Endpoints:   append([]string(nil), workload.Notifications.Endpoints...),
+			SecretFile:  workload.Notifications.SecretFile,
+			MaxAttempts: workload.Notifications.MaxAttempts,
+			Backoff:     metav1.Duration{Duration: workload.Notifications.Backoff},
+		},
+		LabelKeys:     workloadv1beta1.DefaultLabelKeys,
+		IgnoredFields: append([]workloadv1beta1.IgnoredField(nil), resources.DefaultIgnoredFields...),
+	}
+}
+
+// Load reads the configuration file at path over the defaults. It is not
+// validated yet, flags may still override it.
+func Load(path string) (*ControllerConfiguration, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, emperror.Wrap(err, "reading configuration file failed")
+	}
+
+	config := Default()
+	config.TypeMeta = metav1.TypeMeta{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, emperror.WrapWith(err, "parsing configuration file failed", "path", path)
+	}
+	if config.APIVersion != APIVersion || config.Kind != Kind {
+		return nil, fmt.Errorf("unsupported configuration %s %s in %s, expected %s %s",
+			config.APIVersion, config.Kind, path, APIVersion, Kind)
+	}
+	return config, nil
+}
+
+// Validate checks the configuration, from the file and the flags alike
+func (c *ControllerConfiguration) Validate() error {
+	var allErrs field.ErrorList
+
+	if c.MaxConcurrentReconciles < 1 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("maxConcurrentReconciles"), c.MaxConcurrentReconciles,
+			"must be greater than or equal to 1"))
+	}
+	if c.RequeueInterval.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("requeueInterval"), c.RequeueInterval.Duration.String(),
+			"must be greater than 0"))
+	}
+
+	suffix := strings.TrimPrefix(c.DefaultDomainSuffix, ".")
+	for _, msg := range validation.IsDNS1123Subdomain(suffix) {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("defaultDomainSuffix"), c.DefaultDomainSuffix, msg))
+	}
+	for _, msg := range validation.IsValidPortNum(c.ServiceTargetPort) {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("serviceTargetPort"), c.ServiceTargetPort, msg))
+	}
+
+	nsPath := field.NewPath("observedNamespaces")
+	if len(c.ObservedNamespaces) == 0 {
+		allErrs = append(allErrs, field.Required(nsPath, "at least one namespace must be observed"))
+	}
+	for i, ns := range c.ObservedNamespaces {
+		for _, msg := range validation.IsDNS1123Label(ns) {
+			allErrs = append(allErrs, field.Invalid(nsPath.Index(i), ns, msg))
+		}
+	}
+
+	if c.PrometheusURL != "" {
+		allErrs = append(allErrs, validateURL(field.NewPath("prometheusURL"), c.PrometheusURL)...)
+	}
+
+	notificationsPath := field.NewPath("notifications")
+	for i, endpoint := range c.Notifications.Endpoints {
+		allErrs = append(allErrs, validateURL(notificationsPath.Child("endpoints").Index(i), endpoint)...)
+	}
+	if len(c.Notifications.Endpoints) > 0 && c.Notifications.SecretFile == "" {
+		allErrs = append(allErrs, field.Required(notificationsPath.Child("secretFile"), "the notifications must be signed"))
+	}
+	if c.Notifications.MaxAttempts < 1 {
+		allErrs = append(allErrs, field.Invalid(notificationsPath.Child("maxAttempts"), c.Notifications.MaxAttempts,
+			"must be greater than or equal to 1"))
+	}
+	if c.Notifications.Backoff.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(notificationsPath.Child("backoff"), c.Notifications.Backoff.Duration.String(),
+			"must be greater than 0"))
+	}
+
+	allErrs = append(allErrs, c.LabelKeys.Validate(field.NewPath("labelKeys"), true)...)
+
+	for i, ignored := range c.IgnoredFields {
+		if _, err := fieldpath.Parse(ignored.Path); err != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("ignoredFields").Index(i).Child("path"), ignored.Path, err.Error()))
+		}
+	}
+
+	return allErrs.ToAggregate()
+}
+
+func validateURL(fldPath *field.Path, value string) field.ErrorList {
+	u, err := url.Parse(value)
+	if err != nil {
+		return field.ErrorList{field.Invalid(fldPath, value, err.Error())}
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return field.ErrorList{field.Invalid(fldPath, value, "must be an http or https URL")}
+	}
+	return nil
+}
+
+// Apply makes the controller use the configuration, before it is added to the
+// manager
+func (c *ControllerConfiguration) Apply() {
+	workload.MaxConcurrentReconciles = c.MaxConcurrentReconciles
+	workload.RequeueInterval = c.RequeueInterval.Duration
+	workload.PrometheusURL = c.PrometheusURL
+	workloadv1beta1.MetricAnalysisEnabled = c.PrometheusURL != ""
+	workload.Notifications = notify.Options{
+		Endpoints:   c.Notifications.Endpoints,
+		SecretFile:  c.Notifications.SecretFile,
+		MaxAttempts: c.Notifications.MaxAttempts,
+		Backoff:     c.Notifications.Backoff.Duration,
+	}
+	resources.DefaultDomainSuffix = c.DefaultDomainSuffix
+	resources.DefaultIgnoredFields = c.IgnoredFields
+	svc.TargetPort = c.ServiceTargetPort
+	utils.ObservedNamespace = c.ObservedNamespaces
+	workloadv1beta1.DefaultLabelKeys = c.LabelKeys
+}
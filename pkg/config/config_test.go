@@ -0,0 +1,125 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "workload-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeConfig(t, `
+apiVersion: config.workload.dmall.com/v1beta1
+kind: ControllerConfiguration
+maxConcurrentReconciles: 4
+requeueInterval: 1m
+observedNamespaces: [apps]
+labelKeys:
+  ldc: example.com/ldc
+ignoredFields:
+- kind: Deployment
+  path: spec.replicas
+notifications:
+  endpoints: [https://chatops.example.com/hooks/rollouts]
+  secretFile: /etc/workload/notification-secret
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.MaxConcurrentReconciles != 4 || config.RequeueInterval.Duration != time.Minute {
+		t.Errorf("Expected 4 concurrent reconciles every minute, got %d every %v",
+			config.MaxConcurrentReconciles, config.RequeueInterval.Duration)
+	}
+	if len(config.ObservedNamespaces) != 1 || config.ObservedNamespaces[0] != "apps" {
+		t.Errorf("Expected only the apps namespace to be observed, got %v", config.ObservedNamespaces)
+	}
+	if config.LabelKeys.Ldc != "example.com/ldc" || config.LabelKeys.App != Default().LabelKeys.App {
+		t.Errorf("Expected the ldc label key to be set and the others to keep their defaults, got %+v", config.LabelKeys)
+	}
+	if config.ServiceTargetPort != Default().ServiceTargetPort {
+		t.Errorf("Expected the default service target port, got %d", config.ServiceTargetPort)
+	}
+	if len(config.Notifications.Endpoints) != 1 || config.Notifications.MaxAttempts != Default().Notifications.MaxAttempts {
+		t.Errorf("Expected a notification endpoint with the default attempts, got %+v", config.Notifications)
+	}
+	if len(config.IgnoredFields) != 1 || config.IgnoredFields[0].Kind != "Deployment" {
+		t.Errorf("Expected the replicas of Deployments to be ignored, got %v", config.IgnoredFields)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	invalid := map[string]string{
+		"missing kind": `
+apiVersion: config.workload.dmall.com/v1beta1
+`,
+		"unsupported version": `
+apiVersion: config.workload.dmall.com/v1alpha1
+kind: ControllerConfiguration
+`,
+		"unknown field": `
+apiVersion: config.workload.dmall.com/v1beta1
+kind: ControllerConfiguration
+maxConcurrentReconcile: 2
+`,
+		"invalid values": `
+apiVersion: config.workload.dmall.com/v1beta1
+kind: ControllerConfiguration
+maxConcurrentReconciles: 0
+serviceTargetPort: 70000
+labelKeys:
+  app: "not a key"
+ignoredFields:
+- path: spec..replicas
+`,
+		"prometheus URL without scheme": `
+apiVersion: config.workload.dmall.com/v1beta1
+kind: ControllerConfiguration
+prometheusURL: prometheus:9090
+`,
+		"notification endpoint without scheme": `
+apiVersion: config.workload.dmall.com/v1beta1
+kind: ControllerConfiguration
+notifications:
+  endpoints: [chatops/hooks]
+  secretFile: /etc/workload/notification-secret
+`,
+		"notification endpoint without secret": `
+apiVersion: config.workload.dmall.com/v1beta1
+kind: ControllerConfiguration
+notifications:
+  endpoints: [https://chatops.example.com/hooks/rollouts]
+`,
+	}
+	for name, content := range invalid {
+		path := writeConfig(t, content)
+		config, err := Load(path)
+		if err == nil {
+			err = config.Validate()
+		}
+		if err == nil {
+			t.Errorf("Expected the configuration with %s to be rejected", name)
+		}
+		os.RemoveAll(filepath.Dir(path))
+	}
+}
@@ -23,16 +23,27 @@ import (
 	"github.com/gofrs/uuid"
 	"github.com/goph/emperror"
 	kruisev1alpha1 "github.com/openkruise/kruise/pkg/apis/apps/v1alpha1"
+	"github.com/xkcp0324/workload-controller/pkg/analysis"
 	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	"github.com/xkcp0324/workload-controller/pkg/metrics"
+	"github.com/xkcp0324/workload-controller/pkg/notify"
 	"github.com/xkcp0324/workload-controller/pkg/resources"
-	"github.com/xkcp0324/workload-controller/pkg/resources/deployment"
-	"github.com/xkcp0324/workload-controller/pkg/resources/svc"
+	_ "github.com/xkcp0324/workload-controller/pkg/resources/deployment"
+	_ "github.com/xkcp0324/workload-controller/pkg/resources/hpa"
+	_ "github.com/xkcp0324/workload-controller/pkg/resources/ingress"
+	_ "github.com/xkcp0324/workload-controller/pkg/resources/pdb"
+	_ "github.com/xkcp0324/workload-controller/pkg/resources/svc"
+	_ "github.com/xkcp0324/workload-controller/pkg/resources/traffic"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -43,8 +54,47 @@ import (
 // AdvDeploymentReconciler reconciles a AdvDeployment object
 type AdvDeploymentReconciler struct {
 	client.Client
-	Log logr.Logger
-	Mgr manager.Manager
+	Log      logr.Logger
+	Mgr      manager.Manager
+	Recorder record.EventRecorder
+
+	// ctx is cancelled once the manager stops, aborting in-flight API calls
+	ctx context.Context
+	// tracker follows the pods of the revisions being analyzed
+	tracker *analysis.Tracker
+	// prometheus measures the metrics of the rollout analyses, nil without
+	// an endpoint
+	prometheus *analysis.Prometheus
+	// notifier posts the rollout milestones to the webhooks, nil without
+	// endpoints
+	notifier *notify.Notifier
+}
+
+var (
+	// MaxConcurrentReconciles is the number of AdvDeployments reconciled at once
+	MaxConcurrentReconciles = 1
+	// RequeueInterval is how long after a reconcile an AdvDeployment is
+	// reconciled again, to catch up with changes that are not watched
+	RequeueInterval = 20 * time.Second
+	// PrometheusURL is the Prometheus endpoint the metrics of the rollout
+	// analyses are measured against
+	PrometheusURL string
+	// Notifications configures the webhooks notified of the rollout milestones
+	Notifications = notify.Options{MaxAttempts: 5, Backoff: time.Second}
+)
+
+// cancelOnStop cancels the context of the reconciles once the manager stops,
+// leaders and followers alike
+type cancelOnStop context.CancelFunc
+
+func (c cancelOnStop) Start(stop <-chan struct{}) error {
+	<-stop
+	c()
+	return nil
+}
+
+func (c cancelOnStop) NeedLeaderElection() bool {
+	return false
 }
 
 func (r *AdvDeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
@@ -54,22 +104,49 @@ func (r *AdvDeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Owns(&appsv1.StatefulSet{}).
 		Owns(&kruisev1alpha1.StatefulSet{}).
 		Owns(&corev1.Service{}).
+		Owns(&networkingv1beta1.Ingress{}).
+		Owns(&policyv1beta1.PodDisruptionBudget{}).
+		Owns(&autoscalingv1.HorizontalPodAutoscaler{}).
 		WithEventFilter(GetWatchPredicateForNs()).
-		// WithEventFilter(GetWatchPredicateForApp()).
+		WithOptions(controller.Options{MaxConcurrentReconciles: MaxConcurrentReconciles}).
+		// WithEventFilter(GetWatchPredicateForApp(mgr.GetClient())).
 		Watches(&source.Kind{Type: &corev1.Pod{}}, &handler.Funcs{}).
-		// Watches(&source.Kind{Type: &corev1.Pod{}}, &handler.EnqueueRequestsFromMapFunc{ToRequests: GetEnqueueRequestsMapper()}).
+		// Watches(&source.Kind{Type: &corev1.Pod{}}, &handler.EnqueueRequestsFromMapFunc{ToRequests: GetEnqueueRequestsMapper(mgr.GetClient())}).
 		Named("AdvDeployment-controllers").
 		Complete(r)
 }
 
 func Add(mgr manager.Manager) error {
 	reconciler := &AdvDeploymentReconciler{
-		Client: mgr.GetClient(),
-		Mgr:    mgr,
-		Log:    ctrl.Log.WithName("controllers").WithName("AdvDeployment"),
+		Client:   mgr.GetClient(),
+		Mgr:      mgr,
+		Recorder: mgr.GetEventRecorderFor("AdvDeployment-controller"),
+		Log:      ctrl.Log.WithName("controllers").WithName("AdvDeployment"),
+		tracker:  analysis.NewTracker(),
+	}
+	if PrometheusURL != "" {
+		reconciler.prometheus = analysis.NewPrometheus(PrometheusURL)
 	}
 
-	err := reconciler.SetupWithManager(mgr)
+	if len(Notifications.Endpoints) > 0 {
+		notifier, err := notify.New(Notifications)
+		if err != nil {
+			return err
+		}
+		if err := mgr.Add(notifier); err != nil {
+			return emperror.Wrapf(err, "unable to add AdvDeployment notifier")
+		}
+		reconciler.notifier = notifier
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reconciler.ctx = ctx
+	err := mgr.Add(cancelOnStop(cancel))
+	if err != nil {
+		return emperror.Wrapf(err, "unable to add AdvDeployment controller context")
+	}
+
+	err = reconciler.SetupWithManager(mgr)
 	if err != nil {
 		return emperror.Wrapf(err, "unable to create AdvDeployment controller")
 	}
@@ -78,9 +155,18 @@ func Add(mgr manager.Manager) error {
 
 // +kubebuilder:rbac:groups=workload.dmall.com,resources=advdeployments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=workload.dmall.com,resources=advdeployments/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=networking.istio.io,resources=destinationrules;virtualservices,verbs=get;list;watch;create;update;patch;delete
 
 func (r *AdvDeploymentReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(r.ctx)
+	defer cancel()
 	logger := r.Log.WithValues("key", req.NamespacedName, "id", uuid.Must(uuid.NewV4()).String())
 
 	advDeploy := &workloadv1beta1.AdvDeployment{}
@@ -88,57 +174,69 @@ func (r *AdvDeploymentReconciler) Reconcile(req ctrl.Request) (ctrl.Result, erro
 	if err != nil {
 		logger.Error(err, "failed to get AdvDeployment")
 		if apierrors.IsNotFound(err) {
+			metrics.Forget(req.Namespace, req.Name)
 			return reconcile.Result{}, nil
 		}
 
 		return reconcile.Result{}, err
 	}
 
-	rSet := &appsv1.ReplicaSet{}
-	err = r.Client.Get(ctx, types.NamespacedName{Name: "sym-operator-5d8f9f7dcc", Namespace: "sym"}, rSet)
-	if err != nil {
-		logger.Error(err, "failed to get ReplicaSet")
-		if apierrors.IsNotFound(err) {
-			return reconcile.Result{}, nil
-		}
+	if !advDeploy.DeletionTimestamp.IsZero() {
+		return r.finalize(ctx, logger, advDeploy)
+	}
 
+	err = r.ensureFinalizer(ctx, advDeploy)
+	if err != nil {
+		logger.Error(err, "failed to add finalizer")
 		return reconcile.Result{}, err
 	}
 
-	events := &corev1.EventList{}
-	err = r.Client.List(ctx, events)
-	if err != nil {
-		logger.Error(err, "failed to get events")
-		if apierrors.IsNotFound(err) {
-			return reconcile.Result{}, nil
-		}
+	// the validating webhook is optional, nothing is reconciled from an
+	// AdvDeployment it would have rejected until its spec changes
+	if err := advDeploy.Validate(); err != nil {
+		logger.Error(err, "invalid AdvDeployment")
+		r.Recorder.Event(advDeploy, corev1.EventTypeWarning, string(workloadv1beta1.ReconcileFailed), err.Error())
+		return reconcile.Result{}, r.setInvalid(ctx, advDeploy, err)
+	}
 
-		return reconcile.Result{}, err
+	results, reconcileErr := r.reconcile(ctx, logger, advDeploy)
+	if reconcileErr != nil {
+		logger.Error(reconcileErr, "failed to reconcile AdvDeployment")
+		r.Recorder.Event(advDeploy, corev1.EventTypeWarning, string(workloadv1beta1.ReconcileFailed), reconcileErr.Error())
 	}
-	logger.Info("Reconciling get events", "num", len(events.Items))
 
-	_, _ = r.reconcile(logger, advDeploy)
+	err = r.updateStatus(ctx, advDeploy, results, reconcileErr)
+	if err != nil {
+		logger.Error(err, "failed to update AdvDeployment status")
+		return reconcile.Result{}, err
+	}
 
 	logger.Info("Reconciling AdvDeployment")
 	return ctrl.Result{
 		Requeue:      true,
-		RequeueAfter: 20 * time.Second,
+		RequeueAfter: RequeueInterval,
 	}, nil
 }
 
-func (r *AdvDeploymentReconciler) reconcile(logger logr.Logger, config *workloadv1beta1.AdvDeployment) (reconcile.Result, error) {
-	reconcilers := []resources.ComponentReconciler{
-		svc.New(r.Mgr, config, 8080),
-		deployment.New(r.Mgr, config),
+// setInvalid reports in the status that the AdvDeployment failed validation
+func (r *AdvDeploymentReconciler) setInvalid(ctx context.Context, advDeploy *workloadv1beta1.AdvDeployment, err error) error {
+	if advDeploy.Status.Status == workloadv1beta1.ReconcileFailed && advDeploy.Status.Message == err.Error() &&
+		advDeploy.Status.ObservedGeneration == advDeploy.Generation {
+		return nil
 	}
 
-	for _, rec := range reconcilers {
-		err := rec.Reconcile(logger)
-		if err != nil {
-			return reconcile.Result{}, err
-		}
+	advDeploy.Status.ObservedGeneration = advDeploy.Generation
+	advDeploy.Status.Status = workloadv1beta1.ReconcileFailed
+	advDeploy.Status.Message = err.Error()
+	return r.Client.Status().Update(ctx, advDeploy)
+}
+
+func (r *AdvDeploymentReconciler) reconcile(ctx context.Context, logger logr.Logger, config *workloadv1beta1.AdvDeployment) ([]resources.ComponentResult, error) {
+	results, err := resources.ReconcileComponents(ctx, logger, r.Mgr, r.Recorder, config)
+	if err != nil {
+		return results, err
 	}
 
 	logger.Info("reconcile finished")
-	return reconcile.Result{}, nil
+	return results, nil
 }
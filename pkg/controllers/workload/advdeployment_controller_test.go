@@ -0,0 +1,46 @@
+package workload
+
+import (
+	"context"
+	"testing"
+
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReconcileRefusesInvalidAdvDeployment(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := workloadv1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	advDeploy := &workloadv1beta1.AdvDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", Generation: 2},
+	}
+	advDeploy.Spec.RecreatePolicy = "Sometimes"
+
+	c := fake.NewFakeClientWithScheme(scheme, advDeploy)
+	recorder := record.NewFakeRecorder(10)
+	r := &AdvDeploymentReconciler{Client: c, Log: ctrl.Log, Recorder: recorder, ctx: context.TODO()}
+
+	key := types.NamespacedName{Namespace: "default", Name: "app"}
+	if _, err := r.Reconcile(ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	live := &workloadv1beta1.AdvDeployment{}
+	if err := c.Get(context.TODO(), key, live); err != nil {
+		t.Fatal(err)
+	}
+	if live.Status.Status != workloadv1beta1.ReconcileFailed || live.Status.ObservedGeneration != 2 {
+		t.Errorf("Expected generation 2 to be reported as failed, got %+v", live.Status)
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("Expected a single ReconcileFailed event, got %d", len(recorder.Events))
+	}
+}
@@ -0,0 +1,331 @@
+package workload
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goph/emperror"
+	"github.com/xkcp0324/workload-controller/pkg/analysis"
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	"github.com/xkcp0324/workload-controller/pkg/resources"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// revisionAnnotation holds the revision of Deployments and their ReplicaSets
+const revisionAnnotation = "deployment.kubernetes.io/revision"
+
+// rolloutAnalysis is the outcome of analyzing the rollouts of an AdvDeployment
+type rolloutAnalysis struct {
+	// pending names the Deployments whose new pods are still watched
+	pending []string
+	// failure describes the thresholds exceeded, the rollout must be aborted
+	failure string
+	// aborted are the rollouts to abort on failure
+	aborted []workloadv1beta1.AbortedRollout
+}
+
+// analyzeRollouts watches the pods of the new revision of every Deployment
+// and measures its metrics during the analysis window. Once one of them fails
+// the rollouts being analyzed are returned to be aborted, which is left to
+// enforceAborts once they are recorded in the status.
+func (r *AdvDeploymentReconciler) analyzeRollouts(ctx context.Context, advDeploy *workloadv1beta1.AdvDeployment, deploys []*appsv1.Deployment) (rolloutAnalysis, error) {
+	var result rolloutAnalysis
+	spec := advDeploy.Spec.Strategy.Analysis
+
+	var analyzed []workloadv1beta1.AbortedRollout
+	var failures []string
+	for _, deploy := range deploys {
+		current, previous, err := r.revisions(ctx, deploy)
+		if err != nil {
+			return result, err
+		}
+		if current == nil {
+			// the Deployment controller has not caught up yet
+			result.pending = append(result.pending, deploy.Name)
+			continue
+		}
+		if time.Since(current.CreationTimestamp.Time) >= spec.GetWindow() {
+			continue
+		}
+
+		pods, err := r.revisionPods(ctx, current)
+		if err != nil {
+			return result, err
+		}
+		rev := current.Annotations[revisionAnnotation]
+		health := r.tracker.Observe(pods)
+		if exceeded := health.Exceeded(spec); exceeded != "" {
+			failures = append(failures, fmt.Sprintf("%s revision %s: %s", deploy.Name, rev, exceeded))
+		}
+		failures = append(failures, r.measure(ctx, advDeploy, deploy, current)...)
+
+		aborted := workloadv1beta1.AbortedRollout{
+			Deployment:   deploy.Name,
+			TemplateHash: deploy.Annotations[workloadv1beta1.TemplateHashAnnotation],
+			Policy:       spec.GetFailurePolicy(),
+		}
+		if previous != nil && aborted.Policy == workloadv1beta1.RollbackAnalysisFailurePolicy {
+			aborted.RollbackTo = previous.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+		}
+		analyzed = append(analyzed, aborted)
+		result.pending = append(result.pending, deploy.Name)
+	}
+
+	if len(failures) == 0 {
+		return result, nil
+	}
+	result.pending = nil
+	result.failure = strings.Join(failures, "; ")
+	result.aborted = analyzed
+	return result, nil
+}
+
+// resumePaused lifts the aborts of the paused rollouts whose pods are healthy
+// and metrics successful again, and returns the aborts left. The Deployments
+// resume on the next reconcile.
+func (r *AdvDeploymentReconciler) resumePaused(ctx context.Context, advDeploy *workloadv1beta1.AdvDeployment, aborted []workloadv1beta1.AbortedRollout, deploys []*appsv1.Deployment) ([]workloadv1beta1.AbortedRollout, error) {
+	var kept []workloadv1beta1.AbortedRollout
+	for _, rollout := range aborted {
+		var deploy *appsv1.Deployment
+		for _, d := range deploys {
+			if d.Name == rollout.Deployment {
+				deploy = d
+			}
+		}
+		if deploy == nil || rollout.Policy != workloadv1beta1.PauseAnalysisFailurePolicy {
+			kept = append(kept, rollout)
+			continue
+		}
+
+		current, _, err := r.revisions(ctx, deploy)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil {
+			kept = append(kept, rollout)
+			continue
+		}
+		pods, err := r.revisionPods(ctx, current)
+		if err != nil {
+			return nil, err
+		}
+		if r.tracker.Observe(pods).Exceeded(advDeploy.Spec.Strategy.Analysis) != "" || !r.succeeds(ctx, advDeploy, deploy, current) {
+			kept = append(kept, rollout)
+			continue
+		}
+
+		r.Recorder.Eventf(advDeploy, corev1.EventTypeNormal, "Resumed", "Resumed the rollout of Deployment %s, its analysis passes again", deploy.Name)
+	}
+	return kept, nil
+}
+
+// revisionPods lists the pods of the ReplicaSet current
+func (r *AdvDeploymentReconciler) revisionPods(ctx context.Context, current *appsv1.ReplicaSet) ([]corev1.Pod, error) {
+	// the selector of the ReplicaSet includes its pod template hash
+	selector, err := metav1.LabelSelectorAsSelector(current.Spec.Selector)
+	if err != nil {
+		return nil, emperror.WrapWith(err, "invalid selector", "replicaset", current.Name)
+	}
+	pods := &corev1.PodList{}
+	err = r.Client.List(ctx, pods, client.InNamespace(current.Namespace), client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return nil, emperror.WrapWith(err, "failed to list pods", "replicaset", current.Name)
+	}
+	return pods.Items, nil
+}
+
+// enforceAborts rolls back or pauses the Deployments whose rollout is aborted
+// in the status, until they are. It is safe to call again, the Deployments
+// already left as the failure policy wants them are not touched.
+func (r *AdvDeploymentReconciler) enforceAborts(ctx context.Context, advDeploy *workloadv1beta1.AdvDeployment, deploys []*appsv1.Deployment) error {
+	for _, deploy := range deploys {
+		aborted := advDeploy.Status.GetAbortedRollout(deploy.Name, deploy.Annotations[workloadv1beta1.TemplateHashAnnotation])
+		if aborted == nil {
+			continue
+		}
+
+		var err error
+		switch {
+		case aborted.Policy == workloadv1beta1.PauseAnalysisFailurePolicy:
+			err = r.pause(ctx, advDeploy, deploy)
+		case aborted.RollbackTo != "":
+			err = r.rollback(ctx, advDeploy, deploy, aborted.RollbackTo)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// measure runs the metric queries against the revision of current and
+// describes the metrics whose failed measurements exceed their limit. A
+// metric without data yet, or an unreachable Prometheus, is inconclusive and
+// not counted as a failure, the rollout goes on being analyzed.
+func (r *AdvDeploymentReconciler) measure(ctx context.Context, advDeploy *workloadv1beta1.AdvDeployment, deploy *appsv1.Deployment, current *appsv1.ReplicaSet) []string {
+	var failures []string
+	args := queryArgs(advDeploy, deploy, current)
+	metrics := advDeploy.Spec.Strategy.Analysis.Metrics
+	for i := range metrics {
+		metric := &metrics[i]
+		measurement := analysis.Measure(ctx, r.prometheus, metric, args)
+		if measurement.Phase == analysis.Successful {
+			continue
+		}
+		if measurement.Phase == analysis.Inconclusive {
+			r.Log.Info("metric measurement inconclusive", "advdeployment", advDeploy.Name, "deployment", deploy.Name,
+				"metric", metric.Name, "reason", measurement.Reason)
+			continue
+		}
+
+		key := strings.Join([]string{args.Namespace, args.Deployment, args.PodTemplateHash, metric.Name}, "/")
+		count := r.tracker.Failed(key)
+		r.Log.Info("metric measurement failed", "advdeployment", advDeploy.Name, "deployment", deploy.Name,
+			"metric", metric.Name, "reason", measurement.Reason, "count", count)
+		if count <= metric.FailureLimit {
+			continue
+		}
+
+		failures = append(failures, fmt.Sprintf("%s revision %s: metric %s failed %d times, last %s",
+			deploy.Name, args.Revision, metric.Name, count, measurement.Reason))
+	}
+	return failures
+}
+
+// succeeds tells whether every metric is measured successful against the
+// revision of current
+func (r *AdvDeploymentReconciler) succeeds(ctx context.Context, advDeploy *workloadv1beta1.AdvDeployment, deploy *appsv1.Deployment, current *appsv1.ReplicaSet) bool {
+	args := queryArgs(advDeploy, deploy, current)
+	metrics := advDeploy.Spec.Strategy.Analysis.Metrics
+	for i := range metrics {
+		if analysis.Measure(ctx, r.prometheus, &metrics[i], args).Phase != analysis.Successful {
+			return false
+		}
+	}
+	return true
+}
+
+func queryArgs(advDeploy *workloadv1beta1.AdvDeployment, deploy *appsv1.Deployment, current *appsv1.ReplicaSet) analysis.QueryArgs {
+	return analysis.QueryArgs{
+		Namespace:       advDeploy.Namespace,
+		Name:            advDeploy.Name,
+		Deployment:      deploy.Name,
+		Revision:        current.Annotations[revisionAnnotation],
+		PodTemplateHash: current.Labels[appsv1.DefaultDeploymentUniqueLabelKey],
+	}
+}
+
+// revisions returns the ReplicaSet of the current revision of deploy and the
+// one of the revision before, nil when there is none
+func (r *AdvDeploymentReconciler) revisions(ctx context.Context, deploy *appsv1.Deployment) (current, previous *appsv1.ReplicaSet, err error) {
+	selector, err := metav1.LabelSelectorAsSelector(deploy.Spec.Selector)
+	if err != nil {
+		return nil, nil, emperror.WrapWith(err, "invalid selector", "deployment", deploy.Name)
+	}
+
+	rsList := &appsv1.ReplicaSetList{}
+	err = r.Client.List(ctx, rsList, client.InNamespace(deploy.Namespace), client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return nil, nil, emperror.WrapWith(err, "failed to list replicasets", "deployment", deploy.Name)
+	}
+
+	currentRevision := revision(deploy.Annotations)
+	var previousRevision int64
+	for i := range rsList.Items {
+		rs := &rsList.Items[i]
+		if !metav1.IsControlledBy(rs, deploy) {
+			continue
+		}
+
+		rev := revision(rs.Annotations)
+		switch {
+		case rev == currentRevision:
+			current = rs
+		case rev < currentRevision && rev > previousRevision:
+			previous, previousRevision = rs, rev
+		}
+	}
+	return current, previous, nil
+}
+
+func revision(annotations map[string]string) int64 {
+	rev, _ := strconv.ParseInt(annotations[revisionAnnotation], 10, 64)
+	return rev
+}
+
+// rollback sets the pod template of deploy back to the one of its ReplicaSet
+// with the pod-template-hash hash, the Deployment controller scales that
+// ReplicaSet up again
+func (r *AdvDeploymentReconciler) rollback(ctx context.Context, advDeploy *workloadv1beta1.AdvDeployment, deploy *appsv1.Deployment, hash string) error {
+	selector, err := metav1.LabelSelectorAsSelector(deploy.Spec.Selector)
+	if err != nil {
+		return emperror.WrapWith(err, "invalid selector", "deployment", deploy.Name)
+	}
+	rsList := &appsv1.ReplicaSetList{}
+	err = r.Client.List(ctx, rsList, client.InNamespace(deploy.Namespace), client.MatchingLabelsSelector{Selector: selector},
+		client.MatchingLabels{appsv1.DefaultDeploymentUniqueLabelKey: hash})
+	if err != nil {
+		return emperror.WrapWith(err, "failed to list replicasets", "deployment", deploy.Name)
+	}
+
+	var previous *appsv1.ReplicaSet
+	for i := range rsList.Items {
+		if metav1.IsControlledBy(&rsList.Items[i], deploy) {
+			previous = &rsList.Items[i]
+		}
+	}
+	if previous == nil {
+		return fmt.Errorf("ReplicaSet %s of Deployment %s to roll back to is gone", hash, deploy.Name)
+	}
+
+	template := previous.Spec.Template.DeepCopy()
+	delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+	if equality.Semantic.DeepEqual(&deploy.Spec.Template, template) {
+		return nil
+	}
+
+	if (&resources.Reconciler{Config: advDeploy}).IsDryRun() {
+		r.Recorder.Eventf(advDeploy, corev1.EventTypeNormal, "DryRun", "Would have rolled back Deployment %s to revision %s",
+			deploy.Name, previous.Annotations[revisionAnnotation])
+		return nil
+	}
+
+	patch := client.MergeFrom(deploy.DeepCopy())
+	deploy.Spec.Template = *template
+	if err := r.Client.Patch(ctx, deploy, patch); err != nil {
+		return emperror.WrapWith(err, "failed to roll back", "deployment", deploy.Name)
+	}
+
+	r.Recorder.Eventf(advDeploy, corev1.EventTypeNormal, "RolledBack", "Rolled back Deployment %s to revision %s",
+		deploy.Name, previous.Annotations[revisionAnnotation])
+	return nil
+}
+
+// pause stops the rollout of deploy where it is, the pods of both revisions
+// keep running
+func (r *AdvDeploymentReconciler) pause(ctx context.Context, advDeploy *workloadv1beta1.AdvDeployment, deploy *appsv1.Deployment) error {
+	if deploy.Spec.Paused {
+		return nil
+	}
+
+	if (&resources.Reconciler{Config: advDeploy}).IsDryRun() {
+		r.Recorder.Eventf(advDeploy, corev1.EventTypeNormal, "DryRun", "Would have paused Deployment %s", deploy.Name)
+		return nil
+	}
+
+	patch := client.MergeFrom(deploy.DeepCopy())
+	deploy.Spec.Paused = true
+	if err := r.Client.Patch(ctx, deploy, patch); err != nil {
+		return emperror.WrapWith(err, "failed to pause", "deployment", deploy.Name)
+	}
+
+	r.Recorder.Eventf(advDeploy, corev1.EventTypeNormal, "Paused", "Paused Deployment %s", deploy.Name)
+	return nil
+}
@@ -0,0 +1,219 @@
+package workload
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/xkcp0324/workload-controller/pkg/analysis"
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	"github.com/xkcp0324/workload-controller/pkg/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func replicaSet(deploy *appsv1.Deployment, revision, hash, image string, created time.Time) *appsv1.ReplicaSet {
+	labels := map[string]string{"app": "app", appsv1.DefaultDeploymentUniqueLabelKey: hash}
+	return &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              deploy.Name + "-" + hash,
+			Namespace:         deploy.Namespace,
+			Labels:            labels,
+			Annotations:       map[string]string{revisionAnnotation: revision},
+			CreationTimestamp: metav1.NewTime(created),
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: deploy.Name, UID: deploy.UID, Controller: utils.BoolPointer(true)},
+			},
+		},
+		Spec: appsv1.ReplicaSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: image}}},
+			},
+		},
+	}
+}
+
+func TestAnalyzeRolloutsRollsBack(t *testing.T) {
+	advDeploy := &workloadv1beta1.AdvDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", Generation: 2}}
+	advDeploy.Spec.Strategy.Analysis = &workloadv1beta1.RolloutAnalysis{MaxCrashLoops: utils.IntPointer(0)}
+
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "app-gz01b",
+			Namespace:   "default",
+			UID:         "deploy-uid",
+			Annotations: map[string]string{revisionAnnotation: "2", workloadv1beta1.TemplateHashAnnotation: "v2"},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "app"}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "app"}},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "app:v2"}}},
+			},
+		},
+	}
+	previous := replicaSet(deploy, "1", "v1hash", "app:v1", time.Now().Add(-time.Hour))
+	current := replicaSet(deploy, "2", "v2hash", "app:v2", time.Now())
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-gz01b-v2hash-x", Namespace: "default", Labels: current.Labels},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{{
+				RestartCount: 2,
+				State:        corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+			}},
+		},
+	}
+
+	c := fake.NewFakeClient(deploy.DeepCopy(), previous, current, pod)
+	recorder := record.NewFakeRecorder(10)
+	r := &AdvDeploymentReconciler{
+		Client:   c,
+		Recorder: recorder,
+		tracker:  analysis.NewTracker(),
+	}
+
+	result, err := r.analyzeRollouts(context.TODO(), advDeploy, []*appsv1.Deployment{deploy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.failure == "" {
+		t.Fatal("Expected the crash loop to abort the rollout")
+	}
+	if len(result.aborted) != 1 || result.aborted[0].TemplateHash != "v2" || result.aborted[0].RollbackTo != "v1hash" {
+		t.Fatalf("Expected the rollout of v2 to be rolled back to v1hash, got %+v", result.aborted)
+	}
+
+	live := &appsv1.Deployment{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: deploy.Name}, live); err != nil {
+		t.Fatal(err)
+	}
+	if image := live.Spec.Template.Spec.Containers[0].Image; image != "app:v2" {
+		t.Fatalf("Expected the Deployment to be left alone until the abort is recorded, got %s", image)
+	}
+
+	advDeploy.Status.AbortedRollouts = result.aborted
+	// enforcing twice only rolls back once
+	for i := 0; i < 2; i++ {
+		if err := r.enforceAborts(context.TODO(), advDeploy, []*appsv1.Deployment{live}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if events := len(recorder.Events); events != 1 {
+		t.Errorf("Expected a single RolledBack event, got %d", events)
+	}
+
+	live = &appsv1.Deployment{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: deploy.Name}, live); err != nil {
+		t.Fatal(err)
+	}
+	if image := live.Spec.Template.Spec.Containers[0].Image; image != "app:v1" {
+		t.Errorf("Expected the Deployment to be rolled back to app:v1, got %s", image)
+	}
+	if _, ok := live.Spec.Template.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; ok {
+		t.Errorf("Expected the pod template hash not to be rolled back, got %v", live.Spec.Template.Labels)
+	}
+}
+
+func TestAnalyzeRolloutsToleratesMissingDataAndResumes(t *testing.T) {
+	advDeploy := &workloadv1beta1.AdvDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", Generation: 2}}
+	advDeploy.Spec.Strategy.Analysis = &workloadv1beta1.RolloutAnalysis{
+		Metrics:       []workloadv1beta1.MetricAnalysis{{Name: "errors", Query: "errors", Max: "0"}},
+		FailurePolicy: workloadv1beta1.PauseAnalysisFailurePolicy,
+	}
+
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "app-gz01b",
+			Namespace:   "default",
+			UID:         "deploy-uid",
+			Annotations: map[string]string{revisionAnnotation: "2", workloadv1beta1.TemplateHashAnnotation: "v2"},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "app"}},
+		},
+	}
+	current := replicaSet(deploy, "2", "v2hash", "app:v2", time.Now())
+
+	// the new pods have no samples yet at the start of the rollout
+	response := `{"status":"success","data":{"resultType":"vector","result":[]}}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	c := fake.NewFakeClient(deploy.DeepCopy(), current)
+	recorder := record.NewFakeRecorder(10)
+	r := &AdvDeploymentReconciler{
+		Client:     c,
+		Log:        ctrl.Log,
+		Recorder:   recorder,
+		tracker:    analysis.NewTracker(),
+		prometheus: analysis.NewPrometheus(server.URL),
+	}
+
+	for i := 0; i < 3; i++ {
+		result, err := r.analyzeRollouts(context.TODO(), advDeploy, []*appsv1.Deployment{deploy.DeepCopy()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.failure != "" || len(result.pending) != 1 {
+			t.Fatalf("Expected the rollout to go on being analyzed without data, got %+v", result)
+		}
+	}
+
+	response = `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1571234567.1,"3"]}]}}`
+	result, err := r.analyzeRollouts(context.TODO(), advDeploy, []*appsv1.Deployment{deploy.DeepCopy()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.aborted) != 1 || result.aborted[0].Policy != workloadv1beta1.PauseAnalysisFailurePolicy {
+		t.Fatalf("Expected the failed metric to pause the rollout, got %+v", result)
+	}
+
+	kept, err := r.resumePaused(context.TODO(), advDeploy, result.aborted, []*appsv1.Deployment{deploy.DeepCopy()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 1 {
+		t.Fatalf("Expected the rollout to stay paused while the metric fails, got %+v", kept)
+	}
+
+	response = `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1571234567.1,"0"]}]}}`
+	kept, err = r.resumePaused(context.TODO(), advDeploy, result.aborted, []*appsv1.Deployment{deploy.DeepCopy()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 0 {
+		t.Errorf("Expected the rollout to resume once the metric succeeds, got %+v", kept)
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("Expected a single Resumed event, got %d", len(recorder.Events))
+	}
+}
+
+func TestStillAborted(t *testing.T) {
+	aborted := []workloadv1beta1.AbortedRollout{{Deployment: "app-gz01b", TemplateHash: "v2"}}
+	deploy := func(hash string) *appsv1.Deployment {
+		return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+			Name:        "app-gz01b",
+			Annotations: map[string]string{workloadv1beta1.TemplateHashAnnotation: hash},
+		}}
+	}
+
+	// scaling bumps the generation but keeps the pod template
+	if kept := stillAborted(aborted, []*appsv1.Deployment{deploy("v2")}); len(kept) != 1 {
+		t.Errorf("Expected the rollout to stay aborted while the template is unchanged, got %v", kept)
+	}
+	if kept := stillAborted(aborted, []*appsv1.Deployment{deploy("v3")}); len(kept) != 0 {
+		t.Errorf("Expected a new template to lift the abort, got %v", kept)
+	}
+}
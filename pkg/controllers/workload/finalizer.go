@@ -0,0 +1,352 @@
+package workload
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/goph/emperror"
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	"github.com/xkcp0324/workload-controller/pkg/cluster"
+	"github.com/xkcp0324/workload-controller/pkg/metrics"
+	"github.com/xkcp0324/workload-controller/pkg/resources"
+	"github.com/xkcp0324/workload-controller/pkg/resources/traffic"
+	"github.com/xkcp0324/workload-controller/pkg/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	localClusterName = "local"
+
+	teardownRetryInterval = 10 * time.Second
+)
+
+// target is a cluster the children of an AdvDeployment are torn down in
+type target struct {
+	name   string
+	client client.Client
+	// owned tells whether the children carry an owner reference to the
+	// AdvDeployment, which is only possible in its own cluster
+	owned bool
+	// dryRun counts the children that would be torn down without touching them
+	dryRun bool
+}
+
+// manages tells whether obj is a child of advDeploy in the target cluster,
+// by its owner reference or else by its ManagedByAnnotation
+func (t target) manages(advDeploy *workloadv1beta1.AdvDeployment, obj metav1.Object) bool {
+	if t.owned {
+		return metav1.IsControlledBy(obj, advDeploy)
+	}
+	return advDeploy.IsManagedBy(obj)
+}
+
+// ensureFinalizer adds the finalizer in case the defaulting webhook is not
+// installed, unless in dry run
+func (r *AdvDeploymentReconciler) ensureFinalizer(ctx context.Context, advDeploy *workloadv1beta1.AdvDeployment) error {
+	if utils.ContainsString(advDeploy.Finalizers, workloadv1beta1.Finalizer) {
+		return nil
+	}
+	if (&resources.Reconciler{Config: advDeploy}).IsDryRun() {
+		return nil
+	}
+
+	advDeploy.Finalizers = append(advDeploy.Finalizers, workloadv1beta1.Finalizer)
+	return r.Client.Update(ctx, advDeploy)
+}
+
+// finalize tears the children of a deleted AdvDeployment down and removes the
+// finalizer once that succeeded, failures are reported in the status and
+// retried. In dry run the teardown is only reported, the garbage collector
+// still deletes the children owned by the AdvDeployment.
+func (r *AdvDeploymentReconciler) finalize(ctx context.Context, logger logr.Logger, advDeploy *workloadv1beta1.AdvDeployment) (ctrl.Result, error) {
+	if !utils.ContainsString(advDeploy.Finalizers, workloadv1beta1.Finalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	cleanup := r.teardown
+	if advDeploy.Annotations[workloadv1beta1.OrphanAnnotation] == "true" {
+		cleanup = r.release
+	}
+
+	err := cleanup(ctx, logger, advDeploy)
+	if err != nil {
+		logger.Error(err, "failed to tear down AdvDeployment")
+		r.Recorder.Event(advDeploy, corev1.EventTypeWarning, "TeardownFailed", err.Error())
+
+		if advDeploy.Status.Status != workloadv1beta1.Terminating || advDeploy.Status.Message != err.Error() {
+			advDeploy.Status.Status = workloadv1beta1.Terminating
+			advDeploy.Status.Message = err.Error()
+			if err := r.Client.Status().Update(ctx, advDeploy); err != nil {
+				logger.Error(err, "failed to update AdvDeployment status")
+			}
+		}
+		return ctrl.Result{RequeueAfter: teardownRetryInterval}, nil
+	}
+
+	advDeploy.Finalizers = utils.RemoveString(advDeploy.Finalizers, workloadv1beta1.Finalizer)
+	err = r.Client.Update(ctx, advDeploy)
+	if err != nil {
+		return ctrl.Result{}, emperror.Wrap(err, "failed to remove finalizer")
+	}
+
+	metrics.Forget(advDeploy.Namespace, advDeploy.Name)
+	logger.Info("AdvDeployment torn down")
+	return ctrl.Result{}, nil
+}
+
+// teardown first stops the traffic and autoscaling, then scales the Deployments
+// down and finally deletes what is left, in every target cluster
+func (r *AdvDeploymentReconciler) teardown(ctx context.Context, logger logr.Logger, advDeploy *workloadv1beta1.AdvDeployment) error {
+	dryRun := (&resources.Reconciler{Config: advDeploy}).IsDryRun()
+	targets := []target{{name: localClusterName, client: r.Client, owned: true, dryRun: dryRun}}
+
+	members, err := cluster.Clients(ctx, r.Client, r.Mgr.GetScheme(), advDeploy)
+	if err != nil {
+		return err
+	}
+	for name, c := range members {
+		targets = append(targets, target{name: name, client: c, dryRun: dryRun})
+	}
+
+	steps := []struct {
+		name string
+		run  func(context.Context, target, *workloadv1beta1.AdvDeployment) (int, error)
+	}{
+		{name: "traffic", run: r.deleteTraffic},
+		{name: "scale down", run: r.scaleDown},
+		{name: "workloads", run: r.deleteWorkloads},
+	}
+
+	for _, step := range steps {
+		for _, t := range targets {
+			n, err := step.run(ctx, t, advDeploy)
+			if err != nil {
+				return emperror.WrapWith(err, "failed to tear down "+step.name, "cluster", t.name)
+			}
+			if n == 0 {
+				continue
+			}
+			if dryRun {
+				r.Recorder.Eventf(advDeploy, corev1.EventTypeNormal, "DryRun",
+					"Teardown step %q would have handled %d objects in cluster %s", step.name, n, t.name)
+				continue
+			}
+
+			logger.Info("Teardown step done", "step", step.name, "cluster", t.name, "objects", n)
+			r.Recorder.Eventf(advDeploy, corev1.EventTypeNormal, "TornDown",
+				"Teardown step %q handled %d objects in cluster %s", step.name, n, t.name)
+		}
+	}
+	return nil
+}
+
+func (r *AdvDeploymentReconciler) deleteTraffic(ctx context.Context, t target, advDeploy *workloadv1beta1.AdvDeployment) (int, error) {
+	n, err := deleteChildren(ctx, t, advDeploy,
+		&networkingv1beta1.IngressList{},
+		&corev1.ServiceList{},
+		&autoscalingv1.HorizontalPodAutoscalerList{})
+	if err != nil {
+		return n, err
+	}
+
+	// istio types are found by name, they may not even be installed
+	for _, gvk := range []schema.GroupVersionKind{traffic.VirtualServiceGVK, traffic.DestinationRuleGVK} {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+		err := t.client.Get(ctx, types.NamespacedName{Namespace: advDeploy.Namespace, Name: advDeploy.Name}, obj)
+		switch {
+		case apierrors.IsNotFound(err), meta.IsNoMatchError(err):
+			continue
+		case err != nil:
+			return n, err
+		}
+		if !t.manages(advDeploy, obj) {
+			continue
+		}
+		if t.dryRun {
+			n++
+			continue
+		}
+
+		err = t.client.Delete(ctx, obj)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (r *AdvDeploymentReconciler) scaleDown(ctx context.Context, t target, advDeploy *workloadv1beta1.AdvDeployment) (int, error) {
+	deploys := &appsv1.DeploymentList{}
+	err := t.client.List(ctx, deploys, client.InNamespace(advDeploy.Namespace),
+		client.MatchingLabels{advDeploy.GetLabelKeys().App: advDeploy.Name})
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for i := range deploys.Items {
+		deploy := &deploys.Items[i]
+		if !t.manages(advDeploy, deploy) {
+			continue
+		}
+		if deploy.Spec.Replicas != nil && *deploy.Spec.Replicas == 0 {
+			continue
+		}
+		if t.dryRun {
+			n++
+			continue
+		}
+
+		patch := client.MergeFrom(deploy.DeepCopy())
+		deploy.Spec.Replicas = utils.IntPointer(0)
+		err := t.client.Patch(ctx, deploy, patch)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (r *AdvDeploymentReconciler) deleteWorkloads(ctx context.Context, t target, advDeploy *workloadv1beta1.AdvDeployment) (int, error) {
+	return deleteChildren(ctx, t, advDeploy,
+		&appsv1.DeploymentList{},
+		&policyv1beta1.PodDisruptionBudgetList{})
+}
+
+// release removes the owner references to the AdvDeployment from its children
+// in its own cluster, which the garbage collector then leaves alone. The
+// HorizontalPodAutoscaler is deleted as it scales the AdvDeployment itself.
+func (r *AdvDeploymentReconciler) release(ctx context.Context, logger logr.Logger, advDeploy *workloadv1beta1.AdvDeployment) error {
+	dryRun := (&resources.Reconciler{Config: advDeploy}).IsDryRun()
+	t := target{name: localClusterName, client: r.Client, owned: true, dryRun: dryRun}
+	_, err := deleteChildren(ctx, t, advDeploy, &autoscalingv1.HorizontalPodAutoscalerList{})
+	if err != nil {
+		return emperror.Wrap(err, "failed to delete HorizontalPodAutoscaler")
+	}
+
+	var children []runtime.Object
+	for _, list := range []runtime.Object{
+		&appsv1.DeploymentList{},
+		&corev1.ServiceList{},
+		&networkingv1beta1.IngressList{},
+		&policyv1beta1.PodDisruptionBudgetList{},
+	} {
+		err := r.Client.List(ctx, list, client.InNamespace(advDeploy.Namespace),
+			client.MatchingLabels{advDeploy.GetLabelKeys().App: advDeploy.Name})
+		if err != nil {
+			return emperror.Wrap(err, "failed to list children")
+		}
+
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+		children = append(children, items...)
+	}
+
+	for _, gvk := range []schema.GroupVersionKind{traffic.VirtualServiceGVK, traffic.DestinationRuleGVK} {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+		err := r.Client.Get(ctx, types.NamespacedName{Namespace: advDeploy.Namespace, Name: advDeploy.Name}, obj)
+		switch {
+		case err == nil:
+			children = append(children, obj)
+		case apierrors.IsNotFound(err), meta.IsNoMatchError(err):
+		default:
+			return emperror.WrapWith(err, "failed to get child", "kind", gvk.Kind)
+		}
+	}
+
+	n := 0
+	for _, child := range children {
+		obj, ok := child.(metav1.Object)
+		if !ok || !metav1.IsControlledBy(obj, advDeploy) {
+			continue
+		}
+		if dryRun {
+			n++
+			continue
+		}
+
+		patch := client.MergeFrom(child.DeepCopyObject())
+		var refs []metav1.OwnerReference
+		for _, ref := range obj.GetOwnerReferences() {
+			if ref.UID != advDeploy.UID {
+				refs = append(refs, ref)
+			}
+		}
+		obj.SetOwnerReferences(refs)
+
+		err := r.Client.Patch(ctx, child, patch)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return emperror.WrapWith(err, "failed to release child", "name", obj.GetName())
+		}
+		n++
+	}
+
+	if dryRun {
+		r.Recorder.Eventf(advDeploy, corev1.EventTypeNormal, "DryRun", "Would have released %d children", n)
+		return nil
+	}
+
+	logger.Info("Children released", "objects", n)
+	r.Recorder.Eventf(advDeploy, corev1.EventTypeNormal, "Released", "Released %d children", n)
+	return nil
+}
+
+// deleteChildren deletes the objects labelled with the app name that are
+// children of the AdvDeployment in the target cluster
+func deleteChildren(ctx context.Context, t target, advDeploy *workloadv1beta1.AdvDeployment, lists ...runtime.Object) (int, error) {
+	n := 0
+	for _, list := range lists {
+		err := t.client.List(ctx, list, client.InNamespace(advDeploy.Namespace),
+			client.MatchingLabels{advDeploy.GetLabelKeys().App: advDeploy.Name})
+		if err != nil {
+			return n, err
+		}
+
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return n, err
+		}
+
+		for _, item := range items {
+			obj, ok := item.(metav1.Object)
+			if !ok {
+				return n, fmt.Errorf("unexpected list item %T", item)
+			}
+			if !t.manages(advDeploy, obj) {
+				continue
+			}
+			if t.dryRun {
+				n++
+				continue
+			}
+
+			err := t.client.Delete(ctx, item, client.PropagationPolicy(metav1.DeletePropagationForeground))
+			if err != nil && !apierrors.IsNotFound(err) {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
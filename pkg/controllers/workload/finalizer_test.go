@@ -0,0 +1,113 @@
+package workload
+
+import (
+	"context"
+	"testing"
+
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	"github.com/xkcp0324/workload-controller/pkg/resources"
+	"github.com/xkcp0324/workload-controller/pkg/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestTeardownOnlyTouchesManagedChildrenInMemberClusters(t *testing.T) {
+	advDeploy := &workloadv1beta1.AdvDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "owner-uid"}}
+	labels := map[string]string{"app": "app"}
+
+	managed := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+		Name:        "app-gz01b",
+		Namespace:   "default",
+		Labels:      labels,
+		Annotations: map[string]string{workloadv1beta1.ManagedByAnnotation: advDeploy.ManagedBy()},
+	}}
+	managed.Spec.Replicas = utils.IntPointer(3)
+	unrelated := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app-legacy", Namespace: "default", Labels: labels}}
+	unrelated.Spec.Replicas = utils.IntPointer(3)
+
+	c := fake.NewFakeClient(managed, unrelated)
+	member := target{name: "member", client: c}
+	r := &AdvDeploymentReconciler{}
+
+	n, err := r.scaleDown(context.TODO(), member, advDeploy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("Expected only the managed Deployment to be scaled down, got %d", n)
+	}
+
+	n, err = r.deleteWorkloads(context.TODO(), member, advDeploy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("Expected only the managed Deployment to be deleted, got %d", n)
+	}
+
+	live := &appsv1.Deployment{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "app-legacy"}, live); err != nil {
+		t.Fatalf("Expected the unrelated Deployment to be left, got %v", err)
+	}
+	if *live.Spec.Replicas != 3 {
+		t.Errorf("Expected the unrelated Deployment to keep its replicas, got %d", *live.Spec.Replicas)
+	}
+}
+
+func TestTeardownAndReleaseInDryRunLeaveTheChildren(t *testing.T) {
+	advDeploy := &workloadv1beta1.AdvDeployment{ObjectMeta: metav1.ObjectMeta{
+		Name:        "app",
+		Namespace:   "default",
+		UID:         "owner-uid",
+		Annotations: map[string]string{resources.DryRunAnnotation: "true"},
+	}}
+	deploy := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+		Name:      "app-gz01b",
+		Namespace: "default",
+		Labels:    map[string]string{"app": "app"},
+		OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: "workload.dmall.com/v1beta1", Kind: "AdvDeployment", Name: "app", UID: "owner-uid", Controller: utils.BoolPointer(true)},
+		},
+	}}
+	deploy.Spec.Replicas = utils.IntPointer(3)
+
+	c := fake.NewFakeClient(deploy)
+	recorder := record.NewFakeRecorder(10)
+	r := &AdvDeploymentReconciler{Client: c, Log: ctrl.Log, Recorder: recorder}
+	local := target{name: localClusterName, client: c, owned: true, dryRun: true}
+
+	for _, step := range []func(context.Context, target, *workloadv1beta1.AdvDeployment) (int, error){r.scaleDown, r.deleteWorkloads} {
+		n, err := step(context.TODO(), local, advDeploy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Errorf("Expected the Deployment to be counted, got %d", n)
+		}
+	}
+	if err := r.release(context.TODO(), ctrl.Log, advDeploy); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("Expected a single DryRun event, got %d", len(recorder.Events))
+	}
+
+	live := &appsv1.Deployment{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: deploy.Name}, live); err != nil {
+		t.Fatalf("Expected the Deployment to be left, got %v", err)
+	}
+	if *live.Spec.Replicas != 3 || len(live.OwnerReferences) != 1 {
+		t.Errorf("Expected the Deployment to be left untouched, got %+v", live)
+	}
+
+	if err := r.ensureFinalizer(context.TODO(), advDeploy); err != nil {
+		t.Fatal(err)
+	}
+	if len(advDeploy.Finalizers) != 0 {
+		t.Errorf("Expected no finalizer to be added in dry run, got %v", advDeploy.Finalizers)
+	}
+}
@@ -1,8 +1,14 @@
 package workload
 
 import (
+	"context"
+
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
 	"github.com/xkcp0324/workload-controller/pkg/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
@@ -19,27 +25,30 @@ func isObserveNamespaces(ns string) bool {
 	return false
 }
 
-// isObserveApp
-func isObserveApp(labels map[string]string) bool {
-	if _, ok := labels[utils.ObserveMustLabelAppName]; !ok {
-		return false
-	}
-
-	if _, ok := labels[utils.ObserveMustLabelClusterName]; !ok {
-		return false
+// getObserveApp returns the name of the AdvDeployment in the namespace of obj
+// whose own label keys mark obj as one of its objects, empty when there is none
+func getObserveApp(reader client.Reader, obj metav1.Object) string {
+	labels := obj.GetLabels()
+	if len(labels) == 0 {
+		return ""
 	}
-	return true
-}
 
-func getObserveApp(labels map[string]string) string {
-	if _, ok := labels[utils.ObserveMustLabelClusterName]; !ok {
+	advDeploys := &workloadv1beta1.AdvDeploymentList{}
+	err := reader.List(context.TODO(), advDeploys, client.InNamespace(obj.GetNamespace()))
+	if err != nil {
+		ctrl.Log.WithName("predicates").Error(err, "failed to list AdvDeployments", "namespace", obj.GetNamespace())
 		return ""
 	}
 
-	if va, ok := labels[utils.ObserveMustLabelAppName]; ok {
-		return va
+	for i := range advDeploys.Items {
+		keys := advDeploys.Items[i].GetLabelKeys()
+		if _, ok := labels[keys.Cluster]; !ok {
+			continue
+		}
+		if labels[keys.App] == advDeploys.Items[i].Name {
+			return advDeploys.Items[i].Name
+		}
 	}
-
 	return ""
 }
 
@@ -60,26 +69,34 @@ func GetWatchPredicateForNs() predicate.Funcs {
 	}
 }
 
-func GetWatchPredicateForApp() predicate.Funcs {
+// GetWatchPredicateForApp passes the events of the objects of an
+// AdvDeployment, found with reader by the label keys of each AdvDeployment
+func GetWatchPredicateForApp(reader client.Reader) predicate.Funcs {
 	return predicate.Funcs{
 		CreateFunc: func(e event.CreateEvent) bool {
-			return isObserveApp(e.Meta.GetLabels())
+			return getObserveApp(reader, e.Meta) != ""
 		},
 		DeleteFunc: func(e event.DeleteEvent) bool {
-			return isObserveApp(e.Meta.GetLabels())
+			return getObserveApp(reader, e.Meta) != ""
 		},
 		UpdateFunc: func(e event.UpdateEvent) bool {
-			return isObserveApp(e.MetaNew.GetLabels())
+			return getObserveApp(reader, e.MetaNew) != ""
 		},
 	}
 }
 
-func GetEnqueueRequestsMapper() handler.Mapper {
+// GetEnqueueRequestsMapper maps an object to the AdvDeployment it belongs to,
+// found with reader by the label keys of each AdvDeployment
+func GetEnqueueRequestsMapper(reader client.Reader) handler.Mapper {
 	return handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+		name := getObserveApp(reader, a.Meta)
+		if name == "" {
+			return nil
+		}
 		return []reconcile.Request{
 			{
 				NamespacedName: types.NamespacedName{
-					Name:      getObserveApp(a.Meta.GetLabels()),
+					Name:      name,
 					Namespace: a.Meta.GetNamespace(),
 				},
 			},
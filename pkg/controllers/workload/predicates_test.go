@@ -0,0 +1,41 @@
+package workload
+
+import (
+	"testing"
+
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGetObserveAppUsesTheLabelKeysOfEachAdvDeployment(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := workloadv1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	custom := &workloadv1beta1.AdvDeployment{ObjectMeta: metav1.ObjectMeta{Name: "custom", Namespace: "default"}}
+	custom.Spec.LabelKeys = &workloadv1beta1.LabelKeys{App: "example.com/app"}
+	plain := &workloadv1beta1.AdvDeployment{ObjectMeta: metav1.ObjectMeta{Name: "plain", Namespace: "default"}}
+	c := fake.NewFakeClientWithScheme(scheme, custom, plain)
+
+	cluster := workloadv1beta1.DefaultLabelKeys.Cluster
+	cases := []struct {
+		labels map[string]string
+		want   string
+	}{
+		{labels: map[string]string{cluster: "c", "example.com/app": "custom"}, want: "custom"},
+		{labels: map[string]string{cluster: "c", workloadv1beta1.DefaultLabelKeys.App: "custom"}},
+		{labels: map[string]string{cluster: "c", workloadv1beta1.DefaultLabelKeys.App: "plain"}, want: "plain"},
+		{labels: map[string]string{workloadv1beta1.DefaultLabelKeys.App: "plain"}},
+	}
+
+	for _, tc := range cases {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default", Labels: tc.labels}}
+		if got := getObserveApp(c, pod); got != tc.want {
+			t.Errorf("Expected pod labelled %v to belong to %q, got %q", tc.labels, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package workload
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	"github.com/xkcp0324/workload-controller/pkg/metrics"
+	"github.com/xkcp0324/workload-controller/pkg/notify"
+	"github.com/xkcp0324/workload-controller/pkg/resources"
+	"github.com/xkcp0324/workload-controller/pkg/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// updateStatus aggregates the status of the child Deployments into the
+// AdvDeployment status, the replicas and selector also back the scale subresource
+func (r *AdvDeploymentReconciler) updateStatus(ctx context.Context, advDeploy *workloadv1beta1.AdvDeployment, results []resources.ComponentResult, reconcileErr error) error {
+	selector := map[string]string{
+		advDeploy.GetLabelKeys().App: advDeploy.Name,
+	}
+
+	deploys := &appsv1.DeploymentList{}
+	err := r.Client.List(ctx, deploys, client.InNamespace(advDeploy.Namespace), client.MatchingLabels(selector))
+	if err != nil {
+		return err
+	}
+
+	status := advDeploy.Status.DeepCopy()
+	status.ObservedGeneration = advDeploy.Generation
+	status.Selector = labels.SelectorFromSet(selector).String()
+	status.PodSets = make(map[string]workloadv1beta1.PodSetStatus)
+	status.Replicas = 0
+	status.ReadyReplicas = 0
+
+	rolledOut := true
+	var controlled []*appsv1.Deployment
+	for i := range deploys.Items {
+		deploy := &deploys.Items[i]
+		if !metav1.IsControlledBy(deploy, advDeploy) {
+			continue
+		}
+		controlled = append(controlled, deploy)
+
+		status.PodSets[deploy.Name] = workloadv1beta1.PodSetStatus{
+			Name:                deploy.Name,
+			ObservedGeneration:  deploy.Status.ObservedGeneration,
+			Replicas:            deploy.Status.Replicas,
+			UpdatedReplicas:     deploy.Status.UpdatedReplicas,
+			ReadyReplicas:       deploy.Status.ReadyReplicas,
+			AvailableReplicas:   deploy.Status.AvailableReplicas,
+			UnavailableReplicas: deploy.Status.UnavailableReplicas,
+		}
+		status.Replicas += deploy.Status.Replicas
+		status.ReadyReplicas += deploy.Status.ReadyReplicas
+
+		desired := utils.PointerToInt32(deploy.Spec.Replicas)
+		if deploy.Status.ObservedGeneration < deploy.Generation ||
+			deploy.Status.UpdatedReplicas != desired ||
+			deploy.Status.AvailableReplicas != desired ||
+			deploy.Status.Replicas != desired {
+			rolledOut = false
+		}
+	}
+
+	var desired int32
+	cellReplicas := (&resources.Reconciler{Config: advDeploy}).GetCellReplicas()
+	for _, n := range cellReplicas {
+		desired += n
+	}
+	if len(status.PodSets) != len(cellReplicas) || status.ReadyReplicas != desired {
+		rolledOut = false
+	}
+
+	// an aborted rollout stays aborted until the pod template changes, the
+	// generation also moves with scaling, or a paused one passes again
+	status.AbortedRollouts = stillAborted(status.AbortedRollouts, controlled)
+	var analyzed rolloutAnalysis
+	if advDeploy.Spec.Strategy.Analysis == nil {
+		removeCondition(status, workloadv1beta1.RolloutAnalyzed)
+		status.AbortedRollouts = nil
+	} else {
+		status.AbortedRollouts, err = r.resumePaused(ctx, advDeploy, status.AbortedRollouts, controlled)
+		if err != nil {
+			return err
+		}
+		if len(status.AbortedRollouts) == 0 {
+			analyzed, err = r.analyzeRollouts(ctx, advDeploy, controlled)
+			if err != nil {
+				return err
+			}
+			status.AbortedRollouts = analyzed.aborted
+			setAnalysisCondition(status, advDeploy.Generation, analyzed)
+		}
+	}
+	aborted := len(status.AbortedRollouts) > 0
+
+	switch {
+	case reconcileErr != nil:
+		status.Status = workloadv1beta1.ReconcileFailed
+		status.Message = reconcileErr.Error()
+	case aborted:
+		status.Status = workloadv1beta1.ReconcileFailed
+		if condition := getCondition(status, workloadv1beta1.RolloutAnalyzed); condition != nil {
+			status.Message = condition.Message
+		}
+	case rolledOut && len(analyzed.pending) > 0:
+		status.Status = workloadv1beta1.Reconciling
+		status.Message = fmt.Sprintf("Analyzing the new pods of %s", strings.Join(analyzed.pending, ", "))
+	case rolledOut:
+		status.Status = workloadv1beta1.Available
+		status.Message = ""
+	default:
+		status.Status = workloadv1beta1.Reconciling
+		status.Message = fmt.Sprintf("%d of %d replicas ready", status.ReadyReplicas, desired)
+	}
+
+	for _, result := range results {
+		setComponentCondition(status, result)
+	}
+
+	r.recordTransition(advDeploy, advDeploy.Status.Status, status)
+
+	ready := make(map[string]int32, len(cellReplicas))
+	for cell := range cellReplicas {
+		ready[cell] = status.PodSets[advDeploy.Name+"-"+cell].ReadyReplicas
+	}
+	metrics.ObserveCells(advDeploy.Namespace, advDeploy.Name, cellReplicas, ready)
+	metrics.ObservePhase(advDeploy.Namespace, advDeploy.Name, advDeploy.Status.Status, status.Status)
+
+	if !reflect.DeepEqual(status, &advDeploy.Status) {
+		advDeploy.Status = *status
+		err = r.Client.Status().Update(ctx, advDeploy)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the abort is only acted on once it is recorded, to be kept on the
+	// next reconciles
+	if analyzed.failure != "" {
+		r.Recorder.Eventf(advDeploy, corev1.EventTypeWarning, "RolloutAborted", "Rollout of generation %d aborted: %s",
+			advDeploy.Generation, analyzed.failure)
+		for _, rollout := range analyzed.aborted {
+			if rollout.RollbackTo == "" && rollout.Policy == workloadv1beta1.RollbackAnalysisFailurePolicy {
+				r.Recorder.Eventf(advDeploy, corev1.EventTypeWarning, "RollbackSkipped",
+					"Deployment %s has no previous revision to roll back to", rollout.Deployment)
+			}
+		}
+	}
+	if aborted {
+		return r.enforceAborts(ctx, advDeploy, controlled)
+	}
+	return nil
+}
+
+// stillAborted returns the aborted rollouts whose pod template the
+// Deployments still have
+func stillAborted(aborted []workloadv1beta1.AbortedRollout, deploys []*appsv1.Deployment) []workloadv1beta1.AbortedRollout {
+	var kept []workloadv1beta1.AbortedRollout
+	for _, rollout := range aborted {
+		for _, deploy := range deploys {
+			if deploy.Name == rollout.Deployment && deploy.Annotations[workloadv1beta1.TemplateHashAnnotation] == rollout.TemplateHash {
+				kept = append(kept, rollout)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// recordTransition records the rollout state transitions as events, failures
+// are already recorded by Reconcile, and notifies the webhooks of them
+func (r *AdvDeploymentReconciler) recordTransition(advDeploy *workloadv1beta1.AdvDeployment, from workloadv1beta1.DeployState, status *workloadv1beta1.AdvDeploymentStatus) {
+	to := status.Status
+	if from == to {
+		return
+	}
+
+	notifyStep := func(step notify.Step) {
+		r.notifier.Notify(notify.Payload{
+			Namespace: advDeploy.Namespace,
+			Name:      advDeploy.Name,
+			Revision:  advDeploy.Generation,
+			Step:      step,
+			Status:    string(to),
+			Message:   status.Message,
+			Time:      time.Now(),
+		})
+	}
+
+	switch to {
+	case workloadv1beta1.Reconciling:
+		r.Recorder.Eventf(advDeploy, corev1.EventTypeNormal, string(to), "Rolling out generation %d", advDeploy.Generation)
+		notifyStep(notify.RolloutStarted)
+	case workloadv1beta1.Available:
+		r.Recorder.Eventf(advDeploy, corev1.EventTypeNormal, string(to), "Rolled out generation %d", advDeploy.Generation)
+		notifyStep(notify.RolloutCompleted)
+	case workloadv1beta1.ReconcileFailed:
+		notifyStep(notify.RolloutFailed)
+	}
+}
+
+// setComponentCondition reports the result of a component as its condition,
+// disabled components have none
+func setComponentCondition(status *workloadv1beta1.AdvDeploymentStatus, result resources.ComponentResult) {
+	conditionType := result.Component.ConditionType()
+	if !result.Enabled && result.Err == nil && result.BlockedBy == "" {
+		removeCondition(status, conditionType)
+		return
+	}
+
+	condition := workloadv1beta1.AdvDeploymentCondition{
+		Type:   conditionType,
+		Status: corev1.ConditionTrue,
+		Reason: "Reconciled",
+	}
+	switch {
+	case result.Err != nil:
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = string(workloadv1beta1.ReconcileFailed)
+		condition.Message = result.Err.Error()
+	case result.BlockedBy != "":
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = "DependencyFailed"
+		condition.Message = fmt.Sprintf("Waiting for component %s to reconcile", result.BlockedBy)
+	}
+	setCondition(status, condition)
+}
+
+// setAnalysisCondition reports the outcome of the rollout analysis
+func setAnalysisCondition(status *workloadv1beta1.AdvDeploymentStatus, generation int64, analyzed rolloutAnalysis) {
+	condition := workloadv1beta1.AdvDeploymentCondition{
+		Type:   workloadv1beta1.RolloutAnalyzed,
+		Status: corev1.ConditionTrue,
+		Reason: "Passed",
+	}
+	switch {
+	case analyzed.failure != "":
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = "ThresholdExceeded"
+		condition.Message = fmt.Sprintf("Rollout of generation %d aborted: %s", generation, analyzed.failure)
+	case len(analyzed.pending) > 0:
+		condition.Status = corev1.ConditionUnknown
+		condition.Reason = "Analyzing"
+		condition.Message = fmt.Sprintf("Watching the new pods of %s", strings.Join(analyzed.pending, ", "))
+	}
+	setCondition(status, condition)
+}
+
+// setCondition adds or replaces the condition of its type, the timestamps
+// only move when the condition changes
+func setCondition(status *workloadv1beta1.AdvDeploymentStatus, condition workloadv1beta1.AdvDeploymentCondition) {
+	now := metav1.Now()
+	for i := range status.Conditions {
+		existing := &status.Conditions[i]
+		if existing.Type != condition.Type {
+			continue
+		}
+
+		if existing.Status == condition.Status && existing.Reason == condition.Reason && existing.Message == condition.Message {
+			return
+		}
+		if existing.Status != condition.Status {
+			existing.LastTransitionTime = now
+		}
+		existing.Status = condition.Status
+		existing.Reason = condition.Reason
+		existing.Message = condition.Message
+		existing.LastUpdateTime = now
+		return
+	}
+
+	condition.LastUpdateTime = now
+	condition.LastTransitionTime = now
+	status.Conditions = append(status.Conditions, condition)
+}
+
+func getCondition(status *workloadv1beta1.AdvDeploymentStatus, conditionType workloadv1beta1.AdvDeploymentConditionType) *workloadv1beta1.AdvDeploymentCondition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == conditionType {
+			return &status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+func removeCondition(status *workloadv1beta1.AdvDeploymentStatus, conditionType workloadv1beta1.AdvDeploymentConditionType) {
+	for i, condition := range status.Conditions {
+		if condition.Type == conditionType {
+			status.Conditions = append(status.Conditions[:i:i], status.Conditions[i+1:]...)
+			return
+		}
+	}
+}
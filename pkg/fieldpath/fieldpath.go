@@ -0,0 +1,267 @@
+// Package fieldpath selects fields of objects in their unstructured form. It
+// has no dependencies, for the API types to validate paths with it.
+package fieldpath
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Path selects fields of an object, like spec.replicas. A segment may be
+// followed by a selector in brackets, [name=istio-proxy] selects the list
+// elements whose name is istio-proxy and [sidecar.istio.io/*] the map keys
+// with that prefix, or the single key without the trailing *.
+type Path []segment
+
+type segment struct {
+	key string
+
+	// list element selector
+	listKey   string
+	listValue string
+
+	// map key selector
+	mapKey    string
+	mapPrefix bool
+}
+
+// Parse parses a Path from its string form
+func Parse(path string) (Path, error) {
+	var segments Path
+	for len(path) > 0 {
+		end := strings.IndexAny(path, ".[")
+		if end < 0 {
+			end = len(path)
+		}
+
+		seg := segment{key: path[:end]}
+		if seg.key == "" {
+			return nil, fmt.Errorf("empty segment in field path %q", path)
+		}
+		path = path[end:]
+
+		if strings.HasPrefix(path, "[") {
+			closing := strings.Index(path, "]")
+			if closing < 0 {
+				return nil, fmt.Errorf("unterminated selector in field path %q", path)
+			}
+
+			selector := path[1:closing]
+			if i := strings.Index(selector, "="); i >= 0 {
+				seg.listKey, seg.listValue = selector[:i], selector[i+1:]
+				if seg.listKey == "" {
+					return nil, fmt.Errorf("empty list element selector key in field path %q", path)
+				}
+			} else {
+				seg.mapKey = strings.TrimSuffix(selector, "*")
+				seg.mapPrefix = strings.HasSuffix(selector, "*")
+				if seg.mapKey == "" && !seg.mapPrefix {
+					return nil, fmt.Errorf("empty map key selector in field path %q", path)
+				}
+			}
+			path = path[closing+1:]
+		}
+
+		if strings.HasPrefix(path, ".") {
+			path = path[1:]
+			if path == "" {
+				return nil, fmt.Errorf("trailing . in field path")
+			}
+		} else if path != "" {
+			return nil, fmt.Errorf("unexpected %q in field path", path)
+		}
+
+		segments = append(segments, seg)
+	}
+
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("empty field path")
+	}
+	return segments, nil
+}
+
+func (s segment) matchesKey(k string) bool {
+	if s.mapPrefix {
+		return strings.HasPrefix(k, s.mapKey)
+	}
+	return k == s.mapKey
+}
+
+func (s segment) matchesElement(elem interface{}) bool {
+	m, ok := elem.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	return fmt.Sprint(m[s.listKey]) == s.listValue
+}
+
+// Remove deletes the selected fields from obj
+func (p Path) Remove(obj map[string]interface{}) {
+	remove(obj, p)
+}
+
+func remove(obj interface{}, path Path) {
+	m, ok := obj.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	seg, rest := path[0], path[1:]
+	v, ok := m[seg.key]
+	if !ok {
+		return
+	}
+
+	switch {
+	case seg.listKey != "":
+		list, ok := v.([]interface{})
+		if !ok {
+			return
+		}
+		kept := list[:0:0]
+		for _, elem := range list {
+			if !seg.matchesElement(elem) {
+				kept = append(kept, elem)
+				continue
+			}
+			if len(rest) > 0 {
+				remove(elem, rest)
+				kept = append(kept, elem)
+			}
+		}
+		m[seg.key] = kept
+	case seg.mapKey != "" || seg.mapPrefix:
+		inner, ok := v.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for k, iv := range inner {
+			if !seg.matchesKey(k) {
+				continue
+			}
+			if len(rest) == 0 {
+				delete(inner, k)
+				continue
+			}
+			remove(iv, rest)
+		}
+	default:
+		if len(rest) == 0 {
+			delete(m, seg.key)
+			return
+		}
+		remove(v, rest)
+	}
+}
+
+// Preserve copies the selected fields of from over those of to, dropping
+// them from to where from does not have them
+func (p Path) Preserve(from, to map[string]interface{}) {
+	preserve(from, to, p)
+}
+
+func preserve(from, to map[string]interface{}, path Path) {
+	seg, rest := path[0], path[1:]
+	fv, found := from[seg.key]
+
+	switch {
+	case seg.listKey != "":
+		fl, _ := fv.([]interface{})
+		tl, _ := to[seg.key].([]interface{})
+
+		var matching []interface{}
+		for _, elem := range fl {
+			if seg.matchesElement(elem) {
+				matching = append(matching, elem)
+			}
+		}
+
+		if len(rest) == 0 {
+			merged := make([]interface{}, 0, len(tl)+len(matching))
+			for _, elem := range tl {
+				if !seg.matchesElement(elem) {
+					merged = append(merged, elem)
+				}
+			}
+			merged = append(merged, matching...)
+			if len(merged) > 0 || to[seg.key] != nil {
+				to[seg.key] = merged
+			}
+			return
+		}
+
+		// the nth selected element of to gets the fields of the nth of from
+		n := 0
+		for _, elem := range tl {
+			if !seg.matchesElement(elem) {
+				continue
+			}
+			if n < len(matching) {
+				fm, _ := matching[n].(map[string]interface{})
+				tm, _ := elem.(map[string]interface{})
+				if fm != nil && tm != nil {
+					preserve(fm, tm, rest)
+				}
+			}
+			n++
+		}
+	case seg.mapKey != "" || seg.mapPrefix:
+		fm, _ := fv.(map[string]interface{})
+		tm, _ := to[seg.key].(map[string]interface{})
+		if tm == nil {
+			if len(fm) == 0 {
+				return
+			}
+			tm = make(map[string]interface{})
+			to[seg.key] = tm
+		}
+
+		if len(rest) == 0 {
+			for k := range tm {
+				if seg.matchesKey(k) {
+					delete(tm, k)
+				}
+			}
+		}
+		for k, v := range fm {
+			if !seg.matchesKey(k) {
+				continue
+			}
+			if len(rest) == 0 {
+				tm[k] = v
+				continue
+			}
+
+			inner, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			tinner, ok := tm[k].(map[string]interface{})
+			if !ok {
+				tinner = make(map[string]interface{})
+				tm[k] = tinner
+			}
+			preserve(inner, tinner, rest)
+		}
+	default:
+		if len(rest) == 0 {
+			if found {
+				to[seg.key] = fv
+			} else {
+				delete(to, seg.key)
+			}
+			return
+		}
+
+		fm, ok := fv.(map[string]interface{})
+		if !ok {
+			return
+		}
+		tm, ok := to[seg.key].(map[string]interface{})
+		if !ok {
+			tm = make(map[string]interface{})
+			to[seg.key] = tm
+		}
+		preserve(fm, tm, rest)
+	}
+}
@@ -0,0 +1,35 @@
+package fieldpath
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	valid := []string{
+		"spec.replicas",
+		"spec.template.spec.containers[name=istio-proxy]",
+		"spec.template.spec.containers[name=istio-proxy].image",
+		"metadata.annotations[sidecar.istio.io/*]",
+		"metadata.annotations[*]",
+	}
+	for _, path := range valid {
+		if _, err := Parse(path); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", path, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"spec.",
+		"spec..replicas",
+		"spec.containers[name=app",
+		"spec.containers[]",
+		"spec.containers[=app]",
+		"spec.containers[name=app]x",
+	}
+	for _, path := range invalid {
+		if _, err := Parse(path); err == nil {
+			t.Errorf("Expected %q to be invalid", path)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package healthz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// Checker returns an error as long as what it checks is not healthy or ready
+type Checker func() error
+
+// Ping is a Checker that always succeeds, the process serving it is alive
+func Ping() error {
+	return nil
+}
+
+// Server serves /healthz and /readyz, each failing as soon as one of its checks fails
+type Server struct {
+	addr string
+
+	mu      sync.RWMutex
+	healthz map[string]Checker
+	readyz  map[string]Checker
+}
+
+func NewServer(addr string) *Server {
+	return &Server{
+		addr:    addr,
+		healthz: make(map[string]Checker),
+		readyz:  make(map[string]Checker),
+	}
+}
+
+func (s *Server) AddHealthzCheck(name string, check Checker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.healthz[name] = check
+}
+
+func (s *Server) AddReadyzCheck(name string, check Checker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readyz[name] = check
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", s.checkHandler(s.healthz))
+	mux.Handle("/readyz", s.checkHandler(s.readyz))
+	return mux
+}
+
+func (s *Server) checkHandler(checks map[string]Checker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s.mu.RLock()
+		names := make([]string, 0, len(checks))
+		for name := range checks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var out strings.Builder
+		failed := false
+		for _, name := range names {
+			if err := checks[name](); err != nil {
+				failed = true
+				fmt.Fprintf(&out, "[-]%s failed: %v\n", name, err)
+				continue
+			}
+			fmt.Fprintf(&out, "[+]%s ok\n", name)
+		}
+		s.mu.RUnlock()
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if failed {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, out.String())
+			return
+		}
+
+		if _, verbose := req.URL.Query()["verbose"]; verbose {
+			fmt.Fprint(w, out.String())
+		}
+		fmt.Fprint(w, "ok")
+	})
+}
+
+// Start serves the probes until stop is closed
+func (s *Server) Start(stop <-chan struct{}) error {
+	srv := &http.Server{
+		Addr:    s.addr,
+		Handler: s.Handler(),
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-stop:
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return srv.Shutdown(ctx)
+	}
+}
+
+// Flag is a Checker failing with its message until it is set
+type Flag struct {
+	message string
+	set     int32
+}
+
+func NewFlag(message string) *Flag {
+	return &Flag{message: message}
+}
+
+func (f *Flag) Set() {
+	atomic.StoreInt32(&f.set, 1)
+}
+
+func (f *Flag) Check() error {
+	if atomic.LoadInt32(&f.set) == 0 {
+		return errors.New(f.message)
+	}
+	return nil
+}
+
+type flagRunnable struct {
+	flag               *Flag
+	needLeaderElection bool
+}
+
+func (r *flagRunnable) Start(stop <-chan struct{}) error {
+	r.flag.Set()
+	<-stop
+	return nil
+}
+
+func (r *flagRunnable) NeedLeaderElection() bool {
+	return r.needLeaderElection
+}
+
+// SetOnStart returns a manager Runnable setting flag once the manager starts it,
+// which is after the cache has synced and, with needLeaderElection, once this
+// instance has been elected leader
+func SetOnStart(flag *Flag, needLeaderElection bool) manager.Runnable {
+	return &flagRunnable{
+		flag:               flag,
+		needLeaderElection: needLeaderElection,
+	}
+}
+
+// FilesExist returns a Checker failing as long as one of paths does not exist
+func FilesExist(paths ...string) Checker {
+	return func() error {
+		for _, path := range paths {
+			if _, err := os.Stat(path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,32 @@
+package healthz
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadyzFailsUntilFlagIsSet(t *testing.T) {
+	s := NewServer(":0")
+	s.AddHealthzCheck("ping", Ping)
+	synced := NewFlag("cache not synced")
+	s.AddReadyzCheck("cache-sync", synced.Check)
+
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	if code := get("/healthz"); code != http.StatusOK {
+		t.Fatalf("Expected /healthz %d got %d", http.StatusOK, code)
+	}
+	if code := get("/readyz"); code != http.StatusInternalServerError {
+		t.Fatalf("Expected /readyz %d got %d", http.StatusInternalServerError, code)
+	}
+
+	synced.Set()
+	if code := get("/readyz"); code != http.StatusOK {
+		t.Fatalf("Expected /readyz %d got %d", http.StatusOK, code)
+	}
+}
@@ -0,0 +1,162 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	namespace = "advdeployment"
+)
+
+var phases = []workloadv1beta1.DeployState{
+	workloadv1beta1.Created,
+	workloadv1beta1.Reconciling,
+	workloadv1beta1.Available,
+	workloadv1beta1.ReconcileFailed,
+	workloadv1beta1.Unmanaged,
+	workloadv1beta1.Terminating,
+}
+
+var (
+	CellDesiredReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cell_desired_replicas",
+		Help:      "Desired replicas of an AdvDeployment cell.",
+	}, []string{"namespace", "name", "cell"})
+
+	CellReadyReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cell_ready_replicas",
+		Help:      "Ready replicas of an AdvDeployment cell.",
+	}, []string{"namespace", "name", "cell"})
+
+	RolloutPhase = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "rollout_phase",
+		Help:      "Rollout phase of an AdvDeployment, 1 for the current phase and 0 for the others.",
+	}, []string{"namespace", "name", "phase"})
+
+	RolloutDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rollout_duration_seconds",
+		Help:      "Time from the start of a rollout until the AdvDeployment is available again.",
+		Buckets:   []float64{10, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+	}, []string{"namespace"})
+
+	RecreateFallbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "recreate_fallbacks_total",
+		Help:      "Resources deleted and created again because they could not be updated.",
+	}, []string{"kind"})
+
+	PatchFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "patch_calculation_failures_total",
+		Help:      "Failures to calculate the patch between a live and a desired resource.",
+	}, []string{"kind"})
+
+	Leader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "controller_leader",
+		Help:      "1 when this instance runs the controllers, 0 while it stands by for the leader election.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		CellDesiredReplicas,
+		CellReadyReplicas,
+		RolloutPhase,
+		RolloutDuration,
+		RecreateFallbacks,
+		PatchFailures,
+		Leader,
+	)
+}
+
+// tracker keeps what is needed to observe rollouts and to delete the series
+// of an AdvDeployment once it is gone
+type tracker struct {
+	sync.Mutex
+	cells         map[string][]string
+	rolloutStarts map[string]time.Time
+}
+
+var rollouts = &tracker{
+	cells:         make(map[string][]string),
+	rolloutStarts: make(map[string]time.Time),
+}
+
+// ObserveCells sets the desired and ready replicas of every cell
+func ObserveCells(ns, name string, desired, ready map[string]int32) {
+	rollouts.Lock()
+	defer rollouts.Unlock()
+
+	key := ns + "/" + name
+	for _, cell := range rollouts.cells[key] {
+		if _, ok := desired[cell]; !ok {
+			CellDesiredReplicas.DeleteLabelValues(ns, name, cell)
+			CellReadyReplicas.DeleteLabelValues(ns, name, cell)
+		}
+	}
+
+	cells := make([]string, 0, len(desired))
+	for cell, n := range desired {
+		cells = append(cells, cell)
+		CellDesiredReplicas.WithLabelValues(ns, name, cell).Set(float64(n))
+		CellReadyReplicas.WithLabelValues(ns, name, cell).Set(float64(ready[cell]))
+	}
+	rollouts.cells[key] = cells
+}
+
+// ObservePhase sets the rollout phase, and observes the rollout duration
+// when a rollout started by this process completes
+func ObservePhase(ns, name string, from, to workloadv1beta1.DeployState) {
+	for _, phase := range phases {
+		value := 0.0
+		if phase == to {
+			value = 1
+		}
+		RolloutPhase.WithLabelValues(ns, name, string(phase)).Set(value)
+	}
+
+	if from == to {
+		return
+	}
+
+	rollouts.Lock()
+	defer rollouts.Unlock()
+
+	key := ns + "/" + name
+	switch to {
+	case workloadv1beta1.Reconciling:
+		rollouts.rolloutStarts[key] = time.Now()
+	case workloadv1beta1.Available:
+		if start, ok := rollouts.rolloutStarts[key]; ok {
+			RolloutDuration.WithLabelValues(ns).Observe(time.Since(start).Seconds())
+			delete(rollouts.rolloutStarts, key)
+		}
+	}
+}
+
+// Forget deletes all the series of a deleted AdvDeployment
+func Forget(ns, name string) {
+	rollouts.Lock()
+	defer rollouts.Unlock()
+
+	key := ns + "/" + name
+	for _, cell := range rollouts.cells[key] {
+		CellDesiredReplicas.DeleteLabelValues(ns, name, cell)
+		CellReadyReplicas.DeleteLabelValues(ns, name, cell)
+	}
+	for _, phase := range phases {
+		RolloutPhase.DeleteLabelValues(ns, name, string(phase))
+	}
+	delete(rollouts.cells, key)
+	delete(rollouts.rolloutStarts, key)
+}
@@ -0,0 +1,215 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/goph/emperror"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// Step is a milestone of a rollout
+type Step string
+
+const (
+	// RolloutStarted is sent when an AdvDeployment starts rolling out a generation
+	RolloutStarted Step = "RolloutStarted"
+	// RolloutCompleted is sent when a generation is rolled out
+	RolloutCompleted Step = "RolloutCompleted"
+	// RolloutFailed is sent when a rollout fails to reconcile or is aborted
+	RolloutFailed Step = "RolloutFailed"
+)
+
+const (
+	// SignatureHeader holds the hex encoded HMAC-SHA256 of the payload keyed
+	// with the secret, as sha256=<signature>
+	SignatureHeader = "X-Workload-Signature"
+	// StepHeader holds the Step of the payload
+	StepHeader = "X-Workload-Step"
+)
+
+// Payload is the JSON body posted to the endpoints
+type Payload struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Revision is the generation of the AdvDeployment rolled out
+	Revision int64     `json:"revision"`
+	Step     Step      `json:"step"`
+	Status   string    `json:"status"`
+	Message  string    `json:"message,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Options configures the Notifier
+type Options struct {
+	// Endpoints are the URLs the payloads are posted to
+	Endpoints []string
+	// SecretFile holds the key every payload is signed with
+	SecretFile string
+	// MaxAttempts is the number of times a payload is posted to an endpoint
+	// before it is dropped
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubled at every retry
+	Backoff time.Duration
+}
+
+// queueSize is the number of payloads waiting to be sent to an endpoint
+// before new ones are dropped
+const queueSize = 100
+
+// Notifier posts the payloads to the endpoints in the background, retrying
+// with an exponential backoff. Every endpoint has its own queue and worker, so
+// a failing endpoint only delays its own payloads. It runs with the manager,
+// on the leader only.
+type Notifier struct {
+	Options
+	Client *http.Client
+
+	log     logr.Logger
+	secret  []byte
+	workers []*worker
+}
+
+// worker sends the payloads queued for a single endpoint
+type worker struct {
+	endpoint string
+	queue    chan Payload
+}
+
+// New returns a Notifier, reading the secret of opts which is required
+func New(opts Options) (*Notifier, error) {
+	if opts.SecretFile == "" {
+		return nil, errors.New("notifications must be signed, a secret file is required")
+	}
+	secret, err := ioutil.ReadFile(opts.SecretFile)
+	if err != nil {
+		return nil, emperror.Wrap(err, "reading notification secret failed")
+	}
+	secret = bytes.TrimSpace(secret)
+	if len(secret) == 0 {
+		return nil, emperror.With(errors.New("notification secret is empty"), "file", opts.SecretFile)
+	}
+
+	n := &Notifier{
+		Options: opts,
+		Client:  &http.Client{Timeout: 10 * time.Second},
+		log:     ctrl.Log.WithName("notify"),
+		secret:  secret,
+	}
+	for _, endpoint := range opts.Endpoints {
+		n.workers = append(n.workers, &worker{endpoint: endpoint, queue: make(chan Payload, queueSize)})
+	}
+	return n, nil
+}
+
+// Notify queues the payload for every endpoint, it is dropped for the
+// endpoints whose queue is full. A nil Notifier drops every payload.
+func (n *Notifier) Notify(payload Payload) {
+	if n == nil {
+		return
+	}
+
+	for _, w := range n.workers {
+		select {
+		case w.queue <- payload:
+		default:
+			n.log.Info("notification queue is full, dropping", "endpoint", w.endpoint,
+				"name", payload.Name, "step", payload.Step)
+		}
+	}
+}
+
+// Start sends the queued payloads until stop is closed
+func (n *Notifier) Start(stop <-chan struct{}) error {
+	var wg sync.WaitGroup
+	for _, w := range n.workers {
+		wg.Add(1)
+		go func(w *worker) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				case payload := <-w.queue:
+					n.send(w.endpoint, payload, stop)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	return nil
+}
+
+// send posts the payload to the endpoint until it succeeds, fails for good or
+// runs out of attempts
+func (n *Notifier) send(endpoint string, payload Payload, stop <-chan struct{}) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		n.log.Error(err, "failed to encode notification", "name", payload.Name, "step", payload.Step)
+		return
+	}
+
+	backoff := n.Backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := n.post(endpoint, payload.Step, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= n.MaxAttempts {
+			n.log.Error(err, "failed to notify", "endpoint", endpoint, "name", payload.Name,
+				"step", payload.Step, "attempts", attempt)
+			return
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post sends body once and tells whether a failure is worth retrying
+func (n *Notifier) post(endpoint string, step Step, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(StepHeader, string(step))
+	req.Header.Set(SignatureHeader, "sha256="+Sign(n.secret, body))
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return true, fmt.Errorf("endpoint responded %s", resp.Status)
+	default:
+		return false, fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of body keyed with secret, for the
+// endpoints to check the payloads
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,149 @@
+package notify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSecret writes the secret s3cret to a file in a new directory, removed
+// by the caller
+func writeSecret(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secretFile := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(secretFile, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return secretFile
+}
+
+func TestNotifierRetriesSignedPayloads(t *testing.T) {
+	secretFile := writeSecret(t)
+	defer os.RemoveAll(filepath.Dir(secretFile))
+
+	attempts := 0
+	received := make(chan Payload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		if signature := req.Header.Get(SignatureHeader); signature != "sha256="+Sign([]byte("s3cret"), body) {
+			t.Errorf("Unexpected signature %s", signature)
+		}
+		if step := req.Header.Get(StepHeader); step != string(RolloutCompleted) {
+			t.Errorf("Expected step %s, got %s", RolloutCompleted, step)
+		}
+
+		var payload Payload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Error(err)
+		}
+		received <- payload
+	}))
+	defer server.Close()
+
+	notifier, err := New(Options{
+		Endpoints:   []string{server.URL},
+		SecretFile:  secretFile,
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go notifier.Start(stop)
+
+	notifier.Notify(Payload{Namespace: "default", Name: "app", Revision: 3, Step: RolloutCompleted, Status: "Available"})
+
+	select {
+	case payload := <-received:
+		if payload.Name != "app" || payload.Revision != 3 || payload.Status != "Available" {
+			t.Errorf("Unexpected payload %+v", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the payload to be posted again after the endpoint failed")
+	}
+}
+
+func TestNotifierGivesUpOnClientErrors(t *testing.T) {
+	attempts := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		attempts <- struct{}{}
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	secretFile := writeSecret(t)
+	defer os.RemoveAll(filepath.Dir(secretFile))
+	notifier, err := New(Options{Endpoints: []string{server.URL}, SecretFile: secretFile, MaxAttempts: 3, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notifier.send(server.URL, Payload{Name: "app", Step: RolloutFailed}, make(chan struct{}))
+	if len(attempts) != 1 {
+		t.Errorf("Expected a single attempt, got %d", len(attempts))
+	}
+}
+
+func TestNotifierRequiresSecret(t *testing.T) {
+	if _, err := New(Options{Endpoints: []string{"https://chatops.example.com"}, MaxAttempts: 3, Backoff: time.Millisecond}); err == nil {
+		t.Error("Expected a notifier without secret to be rejected")
+	}
+}
+
+func TestNotifierIsNotBlockedByFailingEndpoint(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	received := make(chan struct{}, 2)
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		received <- struct{}{}
+	}))
+	defer healthy.Close()
+
+	secretFile := writeSecret(t)
+	defer os.RemoveAll(filepath.Dir(secretFile))
+	notifier, err := New(Options{
+		Endpoints:   []string{failing.URL, healthy.URL},
+		SecretFile:  secretFile,
+		MaxAttempts: 10,
+		Backoff:     time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go notifier.Start(stop)
+
+	notifier.Notify(Payload{Name: "app", Step: RolloutStarted})
+	notifier.Notify(Payload{Name: "app", Step: RolloutCompleted})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the healthy endpoint to be notified while the failing one backs off")
+		}
+	}
+}
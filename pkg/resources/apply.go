@@ -0,0 +1,237 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	"github.com/goph/emperror"
+	"github.com/xkcp0324/workload-controller/pkg/fieldpath"
+	"github.com/xkcp0324/workload-controller/pkg/resources/patch"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// FieldManager owns the fields applied by the controller with server-side apply
+const FieldManager = "workload-controller"
+
+// ServerSideApply makes the resources reconciled with server-side apply
+// instead of three-way patches against the last-applied annotation
+var ServerSideApply bool
+
+// Apply makes the live resource match desired and desiredState with
+// server-side apply, and returns what it had to do for that. Fields owned by
+// other managers, like the replicas set by an autoscaler or injected sidecars,
+// are not taken over: the apply fails with a conflict until they are listed
+// in opts.IgnoredFields, which are not applied. Only the first apply forces
+// the ownership, of the fields the controller set with updates before.
+// Resources still carrying the last-applied annotation are migrated off it
+// first, those that cannot be updated in place are replaced according to
+// opts.RecreatePolicy.
+func Apply(ctx context.Context, log logr.Logger, c client.Client, scheme *runtime.Scheme, desired runtime.Object, desiredState DesiredState, opts ReconcileOptions, dryRun bool) (Action, error) {
+	if desiredState == "" {
+		desiredState = DesiredStatePresent
+	}
+
+	desiredType := reflect.TypeOf(desired)
+	var current = desired.DeepCopyObject()
+	key, err := client.ObjectKeyFromObject(current)
+	if err != nil {
+		return ActionNone, emperror.With(err, "kind", desiredType)
+	}
+	log = log.WithValues("kind", desiredType, "name", key.Name, "dryRun", dryRun)
+
+	found := true
+	err = c.Get(ctx, key, current)
+	if apierrors.IsNotFound(err) {
+		found = false
+	} else if err != nil {
+		return ActionNone, emperror.WrapWith(err, "getting resource failed", "kind", desiredType, "name", key.Name)
+	}
+
+	if desiredState == DesiredStateAbsent {
+		if !found {
+			return ActionNone, nil
+		}
+		if !opts.deletable(current) {
+			log.Info("resource is not controlled by the AdvDeployment, leaving it")
+			return ActionNone, nil
+		}
+
+		var deleteOpts []client.DeleteOption
+		if dryRun {
+			deleteOpts = append(deleteOpts, client.DryRunAll)
+		}
+		if err := c.Delete(ctx, current, deleteOpts...); err != nil {
+			return ActionNone, emperror.WrapWith(err, "deleting resource failed", "kind", desiredType, "name", key.Name)
+		}
+		log.Info("resource deleted")
+		return ActionDeleted, nil
+	}
+
+	if found && isDeleting(current) {
+		log.Info("resource is being deleted, waiting to create it again")
+		return ActionNone, nil
+	}
+
+	var patchOpts []client.PatchOption
+	if dryRun {
+		patchOpts = append(patchOpts, client.DryRunAll)
+	}
+
+	if found {
+		original, err := patch.DefaultAnnotator.GetOriginalConfiguration(current)
+		if err != nil {
+			return ActionNone, err
+		}
+		if original != nil {
+			// the annotation was set with updates, so applying without it
+			// would not remove it
+			removal := fmt.Sprintf(`{"metadata":{"annotations":{%q:null}}}`, patch.LastAppliedConfig)
+			err := c.Patch(ctx, current, client.ConstantPatch(types.MergePatchType, []byte(removal)), patchOpts...)
+			if err != nil {
+				return ActionNone, emperror.WrapWith(err, "removing last applied annotation failed", "kind", desiredType, "name", key.Name)
+			}
+			log.Info("resource migrated off the last applied annotation")
+		}
+	}
+
+	// apply requests need the type of the object, which typed objects leave empty
+	gvk, err := apiutil.GVKForObject(desired, scheme)
+	if err != nil {
+		return ActionNone, emperror.With(err, "kind", desiredType)
+	}
+	desired.GetObjectKind().SetGroupVersionKind(gvk)
+
+	metaAccessor := meta.NewAccessor()
+	currentResourceVersion, err := metaAccessor.ResourceVersion(current)
+	if err != nil {
+		return ActionNone, err
+	}
+	metaAccessor.SetResourceVersion(desired, "")
+
+	desiredCopy := desired.DeepCopyObject()
+	applied, err := withoutFields(desired, opts.IgnoredFields)
+	if err != nil {
+		return ActionNone, emperror.With(err, "kind", desiredType)
+	}
+
+	patchOpts = append(patchOpts, client.FieldOwner(FieldManager))
+	if found && !appliedBefore(current) {
+		patchOpts = append(patchOpts, client.ForceOwnership)
+	}
+	if err := c.Patch(ctx, applied, client.Apply, patchOpts...); err != nil {
+		if apierrors.IsConflict(err) {
+			return ActionNone, emperror.WrapWith(err, "fields are owned by other managers, ignore them with spec.ignoredFields",
+				"kind", desiredType, "name", key.Name)
+		}
+		if found && apierrors.IsInvalid(err) {
+			if dryRun && checkRecreate(opts.RecreatePolicy, current, desiredCopy) == nil {
+				log.Info("resource would be re-created", "error", err, "policy", opts.RecreatePolicy)
+				return ActionRecreated, nil
+			}
+			if !dryRun {
+				return recreate(ctx, log, c, current, desiredCopy, opts.RecreatePolicy, err, client.FieldOwner(FieldManager))
+			}
+		}
+		return ActionNone, emperror.WrapWith(err, "applying resource failed", "kind", desiredType, "name", key.Name)
+	}
+
+	if u, ok := applied.(*unstructured.Unstructured); ok && applied != desired {
+		if du, ok := desired.(runtime.Unstructured); ok {
+			du.SetUnstructuredContent(u.Object)
+		} else if err := fromUnstructured(u.Object, desired); err != nil {
+			return ActionNone, emperror.With(err, "kind", desiredType)
+		}
+	}
+
+	if !found {
+		log.Info("resource created")
+		return ActionCreated, nil
+	}
+
+	appliedResourceVersion, err := metaAccessor.ResourceVersion(desired)
+	if err != nil {
+		return ActionNone, err
+	}
+	// dry runs are not persisted, so the resource version does not tell
+	// whether anything would have changed
+	if dryRun && equalIgnoringFieldManagement(current, desired) || !dryRun && appliedResourceVersion == currentResourceVersion {
+		log.V(1).Info("resource is in sync")
+		return ActionNone, nil
+	}
+
+	log.Info("resource updated")
+	return ActionUpdated, nil
+}
+
+// equalIgnoringFieldManagement compares two versions of an object, ignoring the
+// metadata bookkeeping an apply changes even without changes to the object
+func equalIgnoringFieldManagement(a, b runtime.Object) bool {
+	a, b = a.DeepCopyObject(), b.DeepCopyObject()
+	for _, obj := range []runtime.Object{a, b} {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return false
+		}
+		accessor.SetManagedFields(nil)
+		accessor.SetResourceVersion("")
+		obj.GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{})
+	}
+	return equality.Semantic.DeepEqual(a, b)
+}
+
+// withoutFields returns obj without the fields selected by paths, as an
+// unstructured copy unless there is nothing to leave out
+func withoutFields(obj runtime.Object, paths []fieldpath.Path) (runtime.Object, error) {
+	if len(paths) == 0 {
+		return obj, nil
+	}
+
+	var content map[string]interface{}
+	if u, ok := obj.(runtime.Unstructured); ok {
+		content = runtime.DeepCopyJSON(u.UnstructuredContent())
+	} else {
+		var err error
+		content, err = runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, path := range paths {
+		path.Remove(content)
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
+
+// appliedBefore tells whether obj was applied by the controller already,
+// otherwise its fields were set with updates
+func appliedBefore(obj runtime.Object) bool {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return false
+	}
+	for _, entry := range accessor.GetManagedFields() {
+		if entry.Manager == FieldManager && entry.Operation == metav1.ManagedFieldsOperationApply {
+			return true
+		}
+	}
+	return false
+}
+
+// fromUnstructured converts content into obj, starting over from its zero value
+func fromUnstructured(content map[string]interface{}, obj runtime.Object) error {
+	v := reflect.ValueOf(obj).Elem()
+	v.Set(reflect.Zero(v.Type()))
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(content, obj)
+}
@@ -0,0 +1,27 @@
+package resources
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAppliedBefore(t *testing.T) {
+	deploy := &appsv1.Deployment{}
+	deploy.ManagedFields = []metav1.ManagedFieldsEntry{
+		{Manager: FieldManager, Operation: metav1.ManagedFieldsOperationUpdate},
+		{Manager: "kube-controller-manager", Operation: metav1.ManagedFieldsOperationUpdate},
+	}
+	if appliedBefore(deploy) {
+		t.Error("Expected a resource only updated by the controller to take its fields over")
+	}
+
+	deploy.ManagedFields = append(deploy.ManagedFields, metav1.ManagedFieldsEntry{
+		Manager:   FieldManager,
+		Operation: metav1.ManagedFieldsOperationApply,
+	})
+	if !appliedBefore(deploy) {
+		t.Error("Expected a resource applied by the controller to leave the fields of others alone")
+	}
+}
@@ -2,6 +2,10 @@ package deployment
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+
 	"github.com/go-logr/logr"
 	"github.com/goph/emperror"
 	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
@@ -10,8 +14,13 @@ import (
 	"github.com/xkcp0324/workload-controller/pkg/utils"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -21,70 +30,100 @@ const (
 	componentName = "deploy"
 )
 
+func init() {
+	resources.Register(resources.Component{
+		Name: componentName,
+		New: func(mgr manager.Manager, recorder record.EventRecorder, config *workloadv1beta1.AdvDeployment) resources.ComponentReconciler {
+			return New(mgr, recorder, config)
+		},
+	})
+}
+
 type Reconciler struct {
 	resources.Reconciler
 	// other
 
 }
 
-func New(mgr manager.Manager, config *workloadv1beta1.AdvDeployment) *Reconciler {
+func New(mgr manager.Manager, recorder record.EventRecorder, config *workloadv1beta1.AdvDeployment) *Reconciler {
 	return &Reconciler{
 		Reconciler: resources.Reconciler{
-			Mgr:    mgr,
-			Config: config,
+			Mgr:      mgr,
+			Recorder: recorder,
+			Config:   config,
 		},
 	}
 }
 
-func (r *Reconciler) Deployment(cell *workloadv1beta1.CellReplicas) runtime.Object {
-	lb := r.GetDeployLabels(cell.CellName)
+func (r *Reconciler) Deployment(cell *workloadv1beta1.CellReplicas, replicas int32) (runtime.Object, error) {
+	lb, err := r.GetDeployLabels(cell)
+	if err != nil {
+		return nil, err
+	}
+
+	tpl, err := cell.MergePodTemplate(&r.Config.Spec.Template)
+	if err != nil {
+		return nil, emperror.WrapWith(err, "failed to build pod template", "cell", cell.CellName)
+	}
 
 	deploy := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      r.Config.Name + "-" + cell.CellName,
 			Namespace: r.Config.Namespace,
 			Labels:    r.GetSvcLabels(),
-			// Annotations: nil,
 		},
 		Spec: appsv1.DeploymentSpec{
-			Replicas: utils.IntPointer(cell.Replicas),
-			Strategy: templates.DefaultRecreateStrategy(),
+			Replicas:             utils.IntPointer(replicas),
+			Strategy:             templates.DeploymentStrategy(r.Config.Spec.Strategy.DeploymentStrategy),
+			MinReadySeconds:      r.Config.Spec.Strategy.MinReadySeconds,
+			RevisionHistoryLimit: r.Config.Spec.RevisionHistoryLimit,
 			Selector: &metav1.LabelSelector{
 				MatchLabels: lb,
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels:      lb,
-					Annotations: templates.DefaultDeployAnnotations(),
+					// selector labels always win over the template ones
+					Labels:      utils.MergeLabels(tpl.Labels, lb),
+					Annotations: utils.MergeLabels(templates.DefaultDeployAnnotations(), tpl.Annotations),
 				},
-				Spec: r.Config.Spec.Template.Spec,
+				Spec: tpl.Spec,
 			},
 		},
 	}
 
-	if deploy.Spec.Template.Spec.Affinity == nil {
-		deploy.Spec.Template.Spec.Affinity = r.GetAffinity()
+	deploy.Spec.Template.Spec.Affinity = r.GetAffinity(cell.CellName, tpl.Spec.Affinity)
+	deploy.Spec.Template.Spec.TopologySpreadConstraints = r.GetTopologySpreadConstraints(cell.CellName, tpl.Spec.TopologySpreadConstraints)
+
+	hash, err := templateHash(&deploy.Spec.Template)
+	if err != nil {
+		return nil, emperror.WrapWith(err, "failed to hash pod template", "cell", cell.CellName)
 	}
+	deploy.Annotations = map[string]string{workloadv1beta1.TemplateHashAnnotation: hash}
 
 	_ = controllerutil.SetControllerReference(r.Config, deploy, r.Mgr.GetScheme())
-	return deploy
+	return deploy, nil
 }
 
-func (r *Reconciler) DeploymentAll() []runtime.Object {
+func (r *Reconciler) DeploymentAll() ([]runtime.Object, error) {
 	var objs []runtime.Object
 
+	replicas := r.GetCellReplicas()
 	for _, rs := range r.Config.Spec.Strategy.CellReplicas {
-		objs = append(objs, r.Deployment(rs))
+		obj, err := r.Deployment(rs, replicas[rs.CellName])
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, obj)
 	}
-	return objs
+	return objs, nil
 }
 
-func (r *Reconciler) Reconcile(log logr.Logger) error {
+func (r *Reconciler) Reconcile(ctx context.Context, log logr.Logger) error {
 	log = log.WithValues("component", componentName)
 
 	cli := r.Mgr.GetClient()
 	deploylist := &appsv1.DeploymentList{}
-	err := cli.List(context.Background(), deploylist, client.InNamespace(r.Config.Namespace), client.MatchingLabels{"app": r.Config.Name})
+	err := cli.List(ctx, deploylist, client.InNamespace(r.Config.Namespace), client.MatchingLabels{r.Config.GetLabelKeys().App: r.Config.Name})
 	if err != nil {
 		log.Error(err, "list", "name", r.Config.Name)
 		return err
@@ -93,9 +132,24 @@ func (r *Reconciler) Reconcile(log logr.Logger) error {
 	if len(deploylist.Items) == 0 {
 		log.Info("maybe first deploy")
 	}
-	for _, deploy := range r.DeploymentAll() {
-		err := resources.Reconcile(log, r.Mgr.GetClient(), deploy, resources.DesiredStatePresent)
-		// result, err := controllerutil.CreateOrUpdate(context.TODO(), r.Mgr.GetClient(), deploy, func() error {
+	deploys, err := r.DeploymentAll()
+	if err != nil {
+		return err
+	}
+
+	for _, deploy := range deploys {
+		err := r.adopt(ctx, log, deploy.(*appsv1.Deployment))
+		if err != nil {
+			return err
+		}
+
+		err = r.keepAbortedRollout(ctx, deploy.(*appsv1.Deployment))
+		if err != nil {
+			return err
+		}
+
+		err = r.ReconcileResource(ctx, log, deploy, resources.DesiredStatePresent)
+		// result, err := controllerutil.CreateOrUpdate(ctx, r.Mgr.GetClient(), deploy, func() error {
 		// 	return nil
 		// })
 		if err != nil {
@@ -105,3 +159,84 @@ func (r *Reconciler) Reconcile(log logr.Logger) error {
 	log.Info("Reconciled")
 	return nil
 }
+
+// keepAbortedRollout leaves the pod template and pause of the live Deployment
+// as they are once the rollout analysis aborted the rollout of the desired
+// template and rolled it back or paused it, until the template changes again
+func (r *Reconciler) keepAbortedRollout(ctx context.Context, desired *appsv1.Deployment) error {
+	if r.Config.Status.GetAbortedRollout(desired.Name, desired.Annotations[workloadv1beta1.TemplateHashAnnotation]) == nil {
+		return nil
+	}
+
+	live := &appsv1.Deployment{}
+	err := r.Mgr.GetClient().Get(ctx, types.NamespacedName{Namespace: desired.Namespace, Name: desired.Name}, live)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return emperror.WrapWith(err, "failed to get Deployment", "name", desired.Name)
+	}
+
+	desired.Spec.Template = live.Spec.Template
+	desired.Spec.Paused = live.Spec.Paused
+	return nil
+}
+
+// templateHash hashes the desired pod template, like the Deployment
+// controller does for the names of its ReplicaSets
+func templateHash(template *corev1.PodTemplateSpec) (string, error) {
+	data, err := json.Marshal(template)
+	if err != nil {
+		return "", err
+	}
+
+	hasher := fnv.New32a()
+	hasher.Write(data)
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32())), nil
+}
+
+// adopt takes ownership of an existing Deployment named like desired that has
+// no controller yet, as left by apps migrated to AdvDeployments. Its pods keep
+// running as long as the selector is the desired one, which is immutable.
+func (r *Reconciler) adopt(ctx context.Context, log logr.Logger, desired *appsv1.Deployment) error {
+	existing := &appsv1.Deployment{}
+	err := r.Mgr.GetClient().Get(ctx, types.NamespacedName{Namespace: desired.Namespace, Name: desired.Name}, existing)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return emperror.WrapWith(err, "failed to get Deployment", "name", desired.Name)
+	}
+
+	owner := metav1.GetControllerOf(existing)
+	if owner != nil {
+		if owner.UID == r.Config.UID {
+			return nil
+		}
+		return fmt.Errorf("Deployment %s is controlled by %s %s", existing.Name, owner.Kind, owner.Name)
+	}
+
+	if !equality.Semantic.DeepEqual(existing.Spec.Selector, desired.Spec.Selector) {
+		return fmt.Errorf("cannot adopt Deployment %s, its selector %s differs from %s",
+			existing.Name, metav1.FormatLabelSelector(existing.Spec.Selector), metav1.FormatLabelSelector(desired.Spec.Selector))
+	}
+
+	if r.IsDryRun() {
+		r.RecordDryRun(existing, resources.ActionAdopted, "")
+		return nil
+	}
+
+	patch := client.MergeFrom(existing.DeepCopy())
+	err = controllerutil.SetControllerReference(r.Config, existing, r.Mgr.GetScheme())
+	if err != nil {
+		return emperror.WrapWith(err, "failed to set controller reference", "name", existing.Name)
+	}
+	err = r.Mgr.GetClient().Patch(ctx, existing, patch)
+	if err != nil {
+		return emperror.WrapWith(err, "failed to adopt Deployment", "name", existing.Name)
+	}
+
+	log.Info("Deployment adopted", "name", existing.Name)
+	r.RecordAction(existing, resources.ActionAdopted)
+	return nil
+}
@@ -0,0 +1,98 @@
+package hpa
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/goph/emperror"
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	"github.com/xkcp0324/workload-controller/pkg/resources"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+const (
+	componentName = "hpa"
+)
+
+func init() {
+	resources.Register(resources.Component{
+		Name:    componentName,
+		After:   []string{"deploy"},
+		Enabled: func(config *workloadv1beta1.AdvDeployment) bool { return config.Spec.Autoscaling != nil },
+		New: func(mgr manager.Manager, recorder record.EventRecorder, config *workloadv1beta1.AdvDeployment) resources.ComponentReconciler {
+			return New(mgr, recorder, config)
+		},
+	})
+}
+
+type Reconciler struct {
+	resources.Reconciler
+}
+
+func New(mgr manager.Manager, recorder record.EventRecorder, config *workloadv1beta1.AdvDeployment) *Reconciler {
+	return &Reconciler{
+		Reconciler: resources.Reconciler{
+			Mgr:      mgr,
+			Recorder: recorder,
+			Config:   config,
+		},
+	}
+}
+
+// HorizontalPodAutoscaler targets the scale subresource of the AdvDeployment
+// rather than the child Deployments, the controller spreads the replicas itself
+func (r *Reconciler) HorizontalPodAutoscaler() runtime.Object {
+	autoscaling := r.Config.Spec.Autoscaling
+	if autoscaling == nil {
+		autoscaling = &workloadv1beta1.AutoscalingStrategy{}
+	}
+
+	hpa := &autoscalingv1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.Config.Name,
+			Namespace: r.Config.Namespace,
+			Labels:    r.GetSvcLabels(),
+		},
+		Spec: autoscalingv1.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{
+				APIVersion: workloadv1beta1.GroupVersion.String(),
+				Kind:       "AdvDeployment",
+				Name:       r.Config.Name,
+			},
+			MinReplicas:                    autoscaling.MinReplicas,
+			MaxReplicas:                    autoscaling.MaxReplicas,
+			TargetCPUUtilizationPercentage: autoscaling.TargetCPUUtilizationPercentage,
+		},
+	}
+
+	_ = controllerutil.SetControllerReference(r.Config, hpa, r.Mgr.GetScheme())
+	return hpa
+}
+
+func (r *Reconciler) Reconcile(ctx context.Context, log logr.Logger) error {
+	log = log.WithValues("component", componentName)
+
+	desiredState := resources.DesiredStatePresent
+	if r.Config.Spec.Autoscaling == nil {
+		desiredState = resources.DesiredStateAbsent
+	}
+
+	hpa := r.HorizontalPodAutoscaler()
+	err := r.ReconcileResource(ctx, log, hpa, desiredState)
+	if err != nil {
+		return emperror.WrapWith(err, "failed to reconcile resource", "resource", hpa.GetObjectKind().GroupVersionKind())
+	}
+
+	log.Info("Reconciled")
+	return nil
+}
+
+// Cleanup deletes the HorizontalPodAutoscaler once Spec.Autoscaling is removed,
+// the replicas are left where the autoscaler put them
+func (r *Reconciler) Cleanup(ctx context.Context, log logr.Logger) error {
+	return r.Reconcile(ctx, log)
+}
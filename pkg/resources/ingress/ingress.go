@@ -0,0 +1,138 @@
+package ingress
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/goph/emperror"
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	"github.com/xkcp0324/workload-controller/pkg/resources"
+	"github.com/xkcp0324/workload-controller/pkg/utils"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+const (
+	componentName = "ingress"
+
+	ingressClassAnnotation = "kubernetes.io/ingress.class"
+)
+
+func init() {
+	resources.Register(resources.Component{
+		Name:    componentName,
+		After:   []string{"svc"},
+		Enabled: enabled,
+		New: func(mgr manager.Manager, recorder record.EventRecorder, config *workloadv1beta1.AdvDeployment) resources.ComponentReconciler {
+			return New(mgr, recorder, config)
+		},
+	})
+}
+
+// enabled tells whether the domain of config is routed by an Ingress, which
+// it is unless disabled
+func enabled(config *workloadv1beta1.AdvDeployment) bool {
+	return config.Spec.Ingress == nil || !config.Spec.Ingress.Disabled
+}
+
+type Reconciler struct {
+	resources.Reconciler
+}
+
+func New(mgr manager.Manager, recorder record.EventRecorder, config *workloadv1beta1.AdvDeployment) *Reconciler {
+	return &Reconciler{
+		Reconciler: resources.Reconciler{
+			Mgr:      mgr,
+			Recorder: recorder,
+			Config:   config,
+		},
+	}
+}
+
+func (r *Reconciler) Ingress() runtime.Object {
+	strategy := r.Config.Spec.Ingress
+	if strategy == nil {
+		strategy = &workloadv1beta1.IngressStrategy{}
+	}
+
+	path := strategy.Path
+	if path == "" {
+		path = "/"
+	}
+
+	annotations := utils.MergeLabels(nil, strategy.Annotations)
+	if strategy.IngressClass != "" {
+		annotations[ingressClassAnnotation] = strategy.IngressClass
+	}
+
+	domain := r.GetDomain()
+	ing := &networkingv1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        r.Config.Name,
+			Namespace:   r.Config.Namespace,
+			Labels:      r.GetSvcLabels(),
+			Annotations: annotations,
+		},
+		Spec: networkingv1beta1.IngressSpec{
+			Rules: []networkingv1beta1.IngressRule{
+				{
+					Host: domain,
+					IngressRuleValue: networkingv1beta1.IngressRuleValue{
+						HTTP: &networkingv1beta1.HTTPIngressRuleValue{
+							Paths: []networkingv1beta1.HTTPIngressPath{
+								{
+									Path: path,
+									Backend: networkingv1beta1.IngressBackend{
+										ServiceName: r.Config.Spec.ServiceName,
+										ServicePort: intstr.FromString("http"),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if strategy.TLSSecretName != "" {
+		ing.Spec.TLS = []networkingv1beta1.IngressTLS{
+			{
+				Hosts:      []string{domain},
+				SecretName: strategy.TLSSecretName,
+			},
+		}
+	}
+
+	_ = controllerutil.SetControllerReference(r.Config, ing, r.Mgr.GetScheme())
+	return ing
+}
+
+func (r *Reconciler) Reconcile(ctx context.Context, log logr.Logger) error {
+	log = log.WithValues("component", componentName)
+
+	// the ingress is removed again once disabled
+	desiredState := resources.DesiredStatePresent
+	if !enabled(r.Config) {
+		desiredState = resources.DesiredStateAbsent
+	}
+
+	ing := r.Ingress()
+	err := r.ReconcileResource(ctx, log, ing, desiredState)
+	if err != nil {
+		return emperror.WrapWith(err, "failed to reconcile resource", "resource", ing.GetObjectKind().GroupVersionKind())
+	}
+
+	log.Info("Reconciled")
+	return nil
+}
+
+// Cleanup deletes the Ingress once Spec.Ingress.Disabled is set, the domain
+// is left to whatever routes it next
+func (r *Reconciler) Cleanup(ctx context.Context, log logr.Logger) error {
+	return r.Reconcile(ctx, log)
+}
@@ -3,6 +3,10 @@ package patch
 import (
 	"testing"
 
+	"github.com/xkcp0324/workload-controller/pkg/fieldpath"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
@@ -19,3 +23,101 @@ func TestAnnotationRemovedWhenEmpty(t *testing.T) {
 		t.Fatalf("Expected {\"metadata\":{} got %s", string(modified))
 	}
 }
+
+func deployment(replicas int32, annotations map[string]string, containers ...string) *appsv1.Deployment {
+	d := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "app",
+			Namespace:   "default",
+			Annotations: annotations,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+		},
+	}
+	for _, name := range containers {
+		d.Spec.Template.Spec.Containers = append(d.Spec.Template.Spec.Containers, corev1.Container{Name: name, Image: name})
+	}
+	return d
+}
+
+func mustParse(t *testing.T, paths ...string) []fieldpath.Path {
+	var parsed []fieldpath.Path
+	for _, path := range paths {
+		p, err := fieldpath.Parse(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed = append(parsed, p)
+	}
+	return parsed
+}
+
+func TestCalculateIgnoresFields(t *testing.T) {
+	desired := deployment(2, nil, "app")
+	if err := DefaultAnnotator.SetLastAppliedAnnotation(desired); err != nil {
+		t.Fatal(err)
+	}
+
+	current := desired.DeepCopy()
+	current.Spec.Replicas = new(int32)
+	*current.Spec.Replicas = 5
+	current.Annotations["sidecar.istio.io/status"] = "injected"
+	current.Spec.Template.Spec.Containers = append(current.Spec.Template.Spec.Containers,
+		corev1.Container{Name: "istio-proxy", Image: "proxyv2"})
+
+	result, err := DefaultPatchMaker.Calculate(current, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IsEmpty() {
+		t.Fatal("Expected a patch without ignored fields")
+	}
+
+	ignored := mustParse(t,
+		"spec.replicas",
+		"metadata.annotations[sidecar.istio.io/*]",
+		"spec.template.spec.containers[name=istio-proxy]")
+	result, err = DefaultPatchMaker.Calculate(current, desired, IgnoreFields(ignored...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsEmpty() {
+		t.Fatalf("Expected an empty patch, got %s", result.Patch)
+	}
+
+	desired.Spec.Template.Spec.Containers[0].Image = "app:v2"
+	result, err = DefaultPatchMaker.Calculate(current, desired, IgnoreFields(ignored...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IsEmpty() {
+		t.Fatal("Expected a patch for the fields not ignored")
+	}
+}
+
+func TestPreserveFields(t *testing.T) {
+	current := deployment(5, map[string]string{"sidecar.istio.io/status": "injected", "owner": "other"}, "app", "istio-proxy")
+	desired := deployment(2, map[string]string{"owner": "me"}, "app")
+	desired.Spec.Template.Spec.Containers[0].Image = "app:v2"
+
+	err := PreserveFields(current, desired, mustParse(t,
+		"spec.replicas",
+		"metadata.annotations[sidecar.istio.io/*]",
+		"spec.template.spec.containers[name=istio-proxy]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *desired.Spec.Replicas != 5 {
+		t.Errorf("Expected replicas 5 got %d", *desired.Spec.Replicas)
+	}
+	if desired.Annotations["sidecar.istio.io/status"] != "injected" || desired.Annotations["owner"] != "me" {
+		t.Errorf("Expected the sidecar annotation to be kept and owner to stay me, got %v", desired.Annotations)
+	}
+
+	containers := desired.Spec.Template.Spec.Containers
+	if len(containers) != 2 || containers[0].Image != "app:v2" || containers[1].Name != "istio-proxy" {
+		t.Errorf("Expected app:v2 and the istio-proxy sidecar, got %v", containers)
+	}
+}
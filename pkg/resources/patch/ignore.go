@@ -0,0 +1,68 @@
+package patch
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/goph/emperror"
+	"github.com/xkcp0324/workload-controller/pkg/fieldpath"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// removeFromJson deletes the fields selected by paths from the JSON document
+func removeFromJson(doc []byte, paths []fieldpath.Path) ([]byte, error) {
+	if len(doc) == 0 || len(paths) == 0 {
+		return doc, nil
+	}
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal(doc, &obj); err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		path.Remove(obj)
+	}
+	return json.Marshal(obj)
+}
+
+// PreserveFields copies the fields selected by paths from the live object
+// current into desired, so that updating to desired leaves them as they are
+func PreserveFields(current, desired runtime.Object, paths []fieldpath.Path) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	from, err := toUnstructured(current)
+	if err != nil {
+		return emperror.Wrap(err, "Failed to convert current object to unstructured")
+	}
+	to, err := toUnstructured(desired)
+	if err != nil {
+		return emperror.Wrap(err, "Failed to convert desired object to unstructured")
+	}
+
+	for _, path := range paths {
+		path.Preserve(from, to)
+	}
+
+	if u, ok := desired.(runtime.Unstructured); ok {
+		u.SetUnstructuredContent(to)
+		return nil
+	}
+
+	// start over from the zero value, fields dropped from to must not survive
+	v := reflect.ValueOf(desired).Elem()
+	v.Set(reflect.Zero(v.Type()))
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(to, desired)
+	if err != nil {
+		return emperror.Wrap(err, "Failed to convert desired object from unstructured")
+	}
+	return nil
+}
+
+func toUnstructured(obj runtime.Object) (map[string]interface{}, error) {
+	if u, ok := obj.(runtime.Unstructured); ok {
+		return runtime.DeepCopyJSON(u.UnstructuredContent()), nil
+	}
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/goph/emperror"
+	"github.com/xkcp0324/workload-controller/pkg/fieldpath"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
@@ -23,7 +24,31 @@ func NewPatchMaker(annotator *Annotator) *PatchMaker {
 	}
 }
 
-func (p *PatchMaker) Calculate(currentObject, modifiedObject runtime.Object) (*PatchResult, error) {
+// CalculateOption adjusts the documents a patch is calculated from
+type CalculateOption func(current, modified, original []byte) ([]byte, []byte, []byte, error)
+
+// IgnoreFields leaves the fields selected by paths out of the patch, for
+// fields managed by others like the API server defaults, sidecar injection
+// or an autoscaler
+func IgnoreFields(paths ...fieldpath.Path) CalculateOption {
+	return func(current, modified, original []byte) ([]byte, []byte, []byte, error) {
+		current, err := removeFromJson(current, paths)
+		if err != nil {
+			return nil, nil, nil, emperror.Wrap(err, "Failed to remove ignored fields from current object")
+		}
+		modified, err = removeFromJson(modified, paths)
+		if err != nil {
+			return nil, nil, nil, emperror.Wrap(err, "Failed to remove ignored fields from modified object")
+		}
+		original, err = removeFromJson(original, paths)
+		if err != nil {
+			return nil, nil, nil, emperror.Wrap(err, "Failed to remove ignored fields from original object")
+		}
+		return current, modified, original, nil
+	}
+}
+
+func (p *PatchMaker) Calculate(currentObject, modifiedObject runtime.Object, opts ...CalculateOption) (*PatchResult, error) {
 	current, err := json.Marshal(currentObject)
 	if err != nil {
 		return nil, emperror.Wrap(err, "Failed to convert current object to byte sequence")
@@ -49,6 +74,13 @@ func (p *PatchMaker) Calculate(currentObject, modifiedObject runtime.Object) (*P
 		return nil, emperror.Wrap(err, "Failed to get original configuration")
 	}
 
+	for _, opt := range opts {
+		current, modified, original, err = opt(current, modified, original)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	var patch []byte
 
 	switch currentObject.(type) {
@@ -0,0 +1,154 @@
+package pdb
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"github.com/goph/emperror"
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	"github.com/xkcp0324/workload-controller/pkg/resources"
+	"github.com/xkcp0324/workload-controller/pkg/utils"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+const (
+	componentName = "pdb"
+)
+
+func init() {
+	resources.Register(resources.Component{
+		Name:    componentName,
+		After:   []string{"deploy"},
+		Enabled: func(config *workloadv1beta1.AdvDeployment) bool { return config.Spec.PodDisruptionBudget != nil },
+		New: func(mgr manager.Manager, recorder record.EventRecorder, config *workloadv1beta1.AdvDeployment) resources.ComponentReconciler {
+			return New(mgr, recorder, config)
+		},
+	})
+}
+
+type Reconciler struct {
+	resources.Reconciler
+}
+
+func New(mgr manager.Manager, recorder record.EventRecorder, config *workloadv1beta1.AdvDeployment) *Reconciler {
+	return &Reconciler{
+		Reconciler: resources.Reconciler{
+			Mgr:      mgr,
+			Recorder: recorder,
+			Config:   config,
+		},
+	}
+}
+
+// budget returns minAvailable and maxUnavailable, defaulting maxUnavailable
+// to the one of the rolling update, or 1 when the rolling update allows none
+func (r *Reconciler) budget() (*intstr.IntOrString, *intstr.IntOrString) {
+	strategy := r.Config.Spec.PodDisruptionBudget
+	if strategy.MinAvailable != nil || strategy.MaxUnavailable != nil {
+		return strategy.MinAvailable, strategy.MaxUnavailable
+	}
+
+	ds := r.Config.Spec.Strategy.DeploymentStrategy
+	if ds != nil && ds.MaxUnavailable != nil && ds.MaxUnavailable.String() != "0" && ds.MaxUnavailable.String() != "0%" {
+		maxUnavailable := *ds.MaxUnavailable
+		return nil, &maxUnavailable
+	}
+
+	return nil, utils.IntstrPointer(1)
+}
+
+func (r *Reconciler) podDisruptionBudget(name string, matchLabels map[string]string) runtime.Object {
+	minAvailable, maxUnavailable := r.budget()
+
+	pdb := &policyv1beta1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: r.Config.Namespace,
+			Labels:    r.GetSvcLabels(),
+		},
+		Spec: policyv1beta1.PodDisruptionBudgetSpec{
+			MinAvailable:   minAvailable,
+			MaxUnavailable: maxUnavailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: matchLabels,
+			},
+		},
+	}
+
+	_ = controllerutil.SetControllerReference(r.Config, pdb, r.Mgr.GetScheme())
+	return pdb
+}
+
+// PodDisruptionBudgets returns the desired budgets, one for the app or one per cell
+func (r *Reconciler) PodDisruptionBudgets() []runtime.Object {
+	if r.Config.Spec.PodDisruptionBudget == nil {
+		return nil
+	}
+
+	keys := r.Config.GetLabelKeys()
+	if !r.Config.Spec.PodDisruptionBudget.PerCell {
+		return []runtime.Object{
+			r.podDisruptionBudget(r.Config.Name, map[string]string{
+				keys.App: r.Config.Name,
+			}),
+		}
+	}
+
+	var objs []runtime.Object
+	for _, cell := range r.Config.Spec.Strategy.CellReplicas {
+		objs = append(objs, r.podDisruptionBudget(r.Config.Name+"-"+cell.CellName, map[string]string{
+			keys.App:     r.Config.Name,
+			keys.Release: r.Config.Name + "-" + cell.CellName,
+		}))
+	}
+	return objs
+}
+
+func (r *Reconciler) Reconcile(ctx context.Context, log logr.Logger) error {
+	log = log.WithValues("component", componentName)
+
+	desired := make(map[string]bool)
+	for _, pdb := range r.PodDisruptionBudgets() {
+		err := r.ReconcileResource(ctx, log, pdb, resources.DesiredStatePresent)
+		if err != nil {
+			return emperror.WrapWith(err, "failed to reconcile resource", "resource", pdb.GetObjectKind().GroupVersionKind())
+		}
+		desired[pdb.(*policyv1beta1.PodDisruptionBudget).Name] = true
+	}
+
+	// remove the budgets we own but no longer want, e.g. the setting was
+	// removed or switched between per app and per cell
+	pdbList := &policyv1beta1.PodDisruptionBudgetList{}
+	err := r.Mgr.GetClient().List(ctx, pdbList, client.InNamespace(r.Config.Namespace),
+		client.MatchingLabels{r.Config.GetLabelKeys().App: r.Config.Name})
+	if err != nil {
+		return emperror.WrapWith(err, "failed to list PodDisruptionBudgets", "name", r.Config.Name)
+	}
+
+	for i := range pdbList.Items {
+		pdb := &pdbList.Items[i]
+		if desired[pdb.Name] || !metav1.IsControlledBy(pdb, r.Config) {
+			continue
+		}
+
+		err := r.ReconcileResource(ctx, log, pdb, resources.DesiredStateAbsent)
+		if err != nil {
+			return emperror.WrapWith(err, "failed to reconcile resource", "resource", pdb.GetObjectKind().GroupVersionKind())
+		}
+	}
+
+	log.Info("Reconciled")
+	return nil
+}
+
+// Cleanup deletes the budgets we own once Spec.PodDisruptionBudget is removed
+func (r *Reconciler) Cleanup(ctx context.Context, log logr.Logger) error {
+	return r.Reconcile(ctx, log)
+}
@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"github.com/go-logr/logr"
 	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	"github.com/xkcp0324/workload-controller/pkg/fieldpath"
+	"github.com/xkcp0324/workload-controller/pkg/metrics"
 	"github.com/xkcp0324/workload-controller/pkg/utils"
 	// metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"context"
+	"encoding/json"
 	"github.com/goph/emperror"
 	"github.com/xkcp0324/workload-controller/pkg/resources/patch"
 	corev1 "k8s.io/api/core/v1"
@@ -14,9 +17,13 @@ import (
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 	"reflect"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sort"
+	"strings"
 )
 
 type DesiredState string
@@ -26,109 +33,468 @@ const (
 	DesiredStateAbsent  DesiredState = "absent"
 )
 
+// DefaultDomainSuffix is used to compute the domain of an AdvDeployment
+// without Spec.Domain, as <name>.<DefaultDomainSuffix>
+var DefaultDomainSuffix = "dmall.com"
+
+// DryRunAnnotation on an AdvDeployment set to "true" makes the controller only
+// report what it would change, DryRun does the same for all of them
+const DryRunAnnotation = "workload.dmall.com/dry-run"
+
+var DryRun bool
+
+// Action is what Reconcile did to a resource, it doubles as the event reason
+type Action string
+
+const (
+	ActionNone      Action = ""
+	ActionCreated   Action = "Created"
+	ActionUpdated   Action = "Updated"
+	ActionRecreated Action = "Recreated"
+	ActionDeleted   Action = "Deleted"
+	ActionAdopted   Action = "Adopted"
+	ActionReleased  Action = "Released"
+)
+
 type Reconciler struct {
-	Mgr    manager.Manager
-	Config *workloadv1beta1.AdvDeployment
+	Mgr      manager.Manager
+	Recorder record.EventRecorder
+	Config   *workloadv1beta1.AdvDeployment
+}
+
+// IsDryRun tells whether the resources of the AdvDeployment must be left untouched
+func (r *Reconciler) IsDryRun() bool {
+	return DryRun || r.Config.Annotations[DryRunAnnotation] == "true"
+}
+
+// DefaultIgnoredFields are left to other managers for every AdvDeployment,
+// next to its Spec.IgnoredFields
+var DefaultIgnoredFields []workloadv1beta1.IgnoredField
+
+// ReconcileOptions tune how a live resource is made to match the desired one
+type ReconcileOptions struct {
+	// RecreatePolicy replaces resources that cannot be updated in place
+	RecreatePolicy workloadv1beta1.RecreatePolicyType
+	// IgnoredFields are neither diffed nor updated
+	IgnoredFields []fieldpath.Path
+	// Owner must control the live resource for it to be deleted, any
+	// resource is deleted without one
+	Owner metav1.Object
+}
+
+// ReconcileOptions returns the options to reconcile obj with, from the
+// AdvDeployment and the controller defaults
+func (r *Reconciler) ReconcileOptions(obj runtime.Object) (ReconcileOptions, error) {
+	opts := ReconcileOptions{
+		RecreatePolicy: r.Config.Spec.RecreatePolicy,
+		Owner:          r.Config,
+	}
+
+	kind := kindOf(obj)
+	// DefaultIgnoredFields is shared by the concurrent reconciles, it must not
+	// be appended to
+	for _, fields := range [][]workloadv1beta1.IgnoredField{DefaultIgnoredFields, r.Config.Spec.IgnoredFields} {
+		for _, ignored := range fields {
+			if ignored.Kind != "" && ignored.Kind != kind {
+				continue
+			}
+
+			path, err := fieldpath.Parse(ignored.Path)
+			if err != nil {
+				return opts, emperror.WrapWith(err, "invalid ignored field", "kind", ignored.Kind, "path", ignored.Path)
+			}
+			opts.IgnoredFields = append(opts.IgnoredFields, path)
+		}
+	}
+	return opts, nil
+}
+
+// deletable tells whether current may be deleted on behalf of opts.Owner,
+// resources named like ours but created by others are left alone
+func (opts ReconcileOptions) deletable(current runtime.Object) bool {
+	if opts.Owner == nil {
+		return true
+	}
+	accessor, err := meta.Accessor(current)
+	if err != nil {
+		return false
+	}
+	return metav1.IsControlledBy(accessor, opts.Owner)
+}
+
+// kindOf returns the kind of obj, typed objects usually leave theirs empty
+func kindOf(obj runtime.Object) string {
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	if kind == "" {
+		kind = reflect.Indirect(reflect.ValueOf(obj)).Type().Name()
+	}
+	return kind
 }
 
 type ComponentReconciler interface {
-	Reconcile(log logr.Logger) error
+	Reconcile(ctx context.Context, log logr.Logger) error
 }
 
 type Resource func() runtime.Object
 
-func (r *Reconciler) GetSvcLabels() map[string]string {
-	var domain string
-	if r.Config.Spec.Domain != nil {
-		domain = *r.Config.Spec.Domain
-	} else {
-		domain = fmt.Sprintf("%s.dmalll.com", r.Config.Name)
+// GetDomain returns Spec.Domain, or the default domain of the AdvDeployment
+func (r *Reconciler) GetDomain() string {
+	if r.Config.Spec.Domain != nil && *r.Config.Spec.Domain != "" {
+		return *r.Config.Spec.Domain
 	}
+
+	return fmt.Sprintf("%s.%s", r.Config.Name, strings.TrimPrefix(DefaultDomainSuffix, "."))
+}
+
+func (r *Reconciler) GetSvcLabels() map[string]string {
+	keys := r.Config.GetLabelKeys()
 	labels := map[string]string{
-		utils.ObserveMustLabelAppName:          r.Config.Name,
-		utils.ObserveMustLabelLightningDomain0: domain,
+		keys.App:             r.Config.Name,
+		keys.LightningDomain: r.GetDomain(),
 	}
 	return utils.MergeLabels(labels, r.Config.Spec.Strategy.Meta)
 }
 
-func (r *Reconciler) GetDeployLabels(name string) map[string]string {
-	ldcName, groupName, _ := utils.SplitMetaLdcGroupKey(name)
+// GetDeployLabels returns the labels selecting the pods of the cell, it fails
+// for cells whose identity cannot be told from their name
+func (r *Reconciler) GetDeployLabels(cell *workloadv1beta1.CellReplicas) (map[string]string, error) {
+	id, err := cell.Identity()
+	if err != nil {
+		return nil, emperror.With(err, "cell", cell.CellName)
+	}
 
+	keys := r.Config.GetLabelKeys()
 	labels := map[string]string{
-		utils.ObserveMustLabelAppName:     r.Config.Name,
-		utils.ObserveMustLabelReleaseName: r.Config.Name + "-" + name,
-		utils.ObserveMustLabelLdcName:     ldcName,
-		utils.ObserveMustLabelGroupName:   groupName,
+		keys.App:     r.Config.Name,
+		keys.Release: r.Config.Name + "-" + cell.CellName,
+		keys.Ldc:     id.Ldc,
+		keys.Group:   id.Group,
+	}
+	// cells used not to have zones, their selectors must stay the same
+	if id.Zone != "" {
+		labels[keys.Zone] = id.Zone
 	}
 
-	return utils.MergeLabels(labels, r.Config.Spec.Strategy.Meta)
+	return utils.MergeLabels(labels, r.Config.Spec.Strategy.Meta), nil
+}
+
+// GetCellReplicas returns the replicas of every cell by cell name. Without
+// autoscaling these are the declared ones, otherwise Spec.Replicas, owned by
+// the HorizontalPodAutoscaler, is spread across the cells weighted by them.
+func (r *Reconciler) GetCellReplicas() map[string]int32 {
+	cells := r.Config.Spec.Strategy.CellReplicas
+	replicas := make(map[string]int32, len(cells))
+
+	weights := make([]int32, len(cells))
+	var declared int32
+	for i, cell := range cells {
+		weights[i] = cell.Replicas
+		declared += cell.Replicas
+		replicas[cell.CellName] = cell.Replicas
+	}
+
+	autoscaling := r.Config.Spec.Autoscaling
+	if autoscaling == nil {
+		return replicas
+	}
+
+	total := declared
+	if r.Config.Spec.Replicas != nil {
+		total = *r.Config.Spec.Replicas
+	}
+	if autoscaling.MinReplicas != nil && total < *autoscaling.MinReplicas {
+		total = *autoscaling.MinReplicas
+	}
+	if total > autoscaling.MaxReplicas {
+		total = autoscaling.MaxReplicas
+	}
+
+	for i, n := range utils.Distribute(total, weights) {
+		replicas[cells[i].CellName] = n
+	}
+	return replicas
+}
+
+// GetAffinity returns base merged with the pod anti-affinity terms generated
+// from Spec.PodAntiAffinity for the given cell. base is never modified.
+func (r *Reconciler) GetAffinity(cellName string, base *corev1.Affinity) *corev1.Affinity {
+	strategy := r.Config.Spec.PodAntiAffinity
+	if strategy == nil {
+		strategy = &workloadv1beta1.PodAntiAffinityStrategy{}
+	}
+
+	var affinity *corev1.Affinity
+	if base != nil {
+		affinity = base.DeepCopy()
+	} else {
+		affinity = &corev1.Affinity{}
+	}
+
+	if strategy.Type == workloadv1beta1.NonePodAntiAffinityType {
+		return affinity
+	}
+
+	keys := r.Config.GetLabelKeys()
+	matchLabels := map[string]string{
+		keys.App: r.Config.Name,
+	}
+	if strategy.PerCell {
+		matchLabels[keys.Release] = r.Config.Name + "-" + cellName
+	}
+
+	topologyKeys := strategy.TopologyKeys
+	if len(topologyKeys) == 0 {
+		topologyKeys = []string{corev1.LabelHostname}
+	}
+
+	weight := strategy.Weight
+	if weight == 0 {
+		weight = 1
+	}
+
+	if affinity.PodAntiAffinity == nil {
+		affinity.PodAntiAffinity = &corev1.PodAntiAffinity{}
+	}
+	anti := affinity.PodAntiAffinity
+	for _, key := range topologyKeys {
+		term := corev1.PodAffinityTerm{
+			LabelSelector: &metav1.LabelSelector{
+				MatchLabels: matchLabels,
+			},
+			Namespaces:  []string{r.Config.Namespace},
+			TopologyKey: key,
+		}
+
+		if strategy.Type == workloadv1beta1.RequiredPodAntiAffinityType {
+			anti.RequiredDuringSchedulingIgnoredDuringExecution = append(anti.RequiredDuringSchedulingIgnoredDuringExecution, term)
+			continue
+		}
+
+		anti.PreferredDuringSchedulingIgnoredDuringExecution = append(anti.PreferredDuringSchedulingIgnoredDuringExecution,
+			corev1.WeightedPodAffinityTerm{
+				Weight:          weight,
+				PodAffinityTerm: term,
+			})
+	}
+
+	return affinity
 }
 
-func (r *Reconciler) GetAffinity() *corev1.Affinity {
-	return &corev1.Affinity{
-		PodAntiAffinity: &corev1.PodAntiAffinity{
-			PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
-				{
-					Weight: 1,
-					PodAffinityTerm: corev1.PodAffinityTerm{
-						LabelSelector: &metav1.LabelSelector{
-							MatchLabels: map[string]string{
-								utils.ObserveMustLabelAppName: r.Config.Name,
-							},
-						},
-						Namespaces:  []string{r.Config.Namespace},
-						TopologyKey: "kubernetes.io/hostname",
-					},
+// GetTopologySpreadConstraints returns base followed by the constraints
+// generated from Spec.TopologySpread for the pods of the given cell. A topology
+// key base already constrains is left to base. base is never modified.
+func (r *Reconciler) GetTopologySpreadConstraints(cellName string, base []corev1.TopologySpreadConstraint) []corev1.TopologySpreadConstraint {
+	strategy := r.Config.Spec.TopologySpread
+	if strategy == nil {
+		return base
+	}
+
+	constraints := make([]corev1.TopologySpreadConstraint, 0, len(base)+len(strategy.TopologyKeys))
+	constrained := make(map[string]bool, len(base))
+	for i := range base {
+		constraints = append(constraints, *base[i].DeepCopy())
+		constrained[base[i].TopologyKey] = true
+	}
+
+	topologyKeys := strategy.TopologyKeys
+	if len(topologyKeys) == 0 {
+		topologyKeys = []string{corev1.LabelHostname}
+	}
+
+	maxSkew := strategy.MaxSkew
+	if maxSkew == 0 {
+		maxSkew = 1
+	}
+
+	whenUnsatisfiable := strategy.WhenUnsatisfiable
+	if whenUnsatisfiable == "" {
+		whenUnsatisfiable = corev1.ScheduleAnyway
+	}
+
+	keys := r.Config.GetLabelKeys()
+	for _, key := range topologyKeys {
+		if constrained[key] {
+			continue
+		}
+		constraints = append(constraints, corev1.TopologySpreadConstraint{
+			MaxSkew:           maxSkew,
+			TopologyKey:       key,
+			WhenUnsatisfiable: whenUnsatisfiable,
+			LabelSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					keys.App:     r.Config.Name,
+					keys.Release: r.Config.Name + "-" + cellName,
 				},
 			},
-		},
+		})
 	}
+	return constraints
 }
 
+// prepareResourceForUpdate keeps what the API server allocated for current in
+// desired, which would otherwise be rejected or reallocated
 func prepareResourceForUpdate(current, desired runtime.Object) {
 	switch desired.(type) {
 	case *corev1.Service:
 		svc := desired.(*corev1.Service)
-		svc.Spec.ClusterIP = current.(*corev1.Service).Spec.ClusterIP
+		currentSvc := current.(*corev1.Service)
+		svc.Spec.ClusterIP = currentSvc.Spec.ClusterIP
+
+		if svc.Spec.HealthCheckNodePort == 0 && svc.Spec.Type == corev1.ServiceTypeLoadBalancer &&
+			svc.Spec.ExternalTrafficPolicy == corev1.ServiceExternalTrafficPolicyTypeLocal {
+			svc.Spec.HealthCheckNodePort = currentSvc.Spec.HealthCheckNodePort
+		}
+
+		if svc.Spec.Type != corev1.ServiceTypeNodePort && svc.Spec.Type != corev1.ServiceTypeLoadBalancer {
+			return
+		}
+		for i := range svc.Spec.Ports {
+			port := &svc.Spec.Ports[i]
+			if port.NodePort != 0 {
+				continue
+			}
+			for _, currentPort := range currentSvc.Spec.Ports {
+				if currentPort.Port == port.Port && currentPort.Protocol == port.Protocol {
+					port.NodePort = currentPort.NodePort
+					break
+				}
+			}
+		}
+	}
+}
+
+// ReconcileResource reconciles desired like Reconcile, or Apply with
+// ServerSideApply, does and records what was done to it as an event on the
+// AdvDeployment. In dry-run mode what would be done is recorded instead.
+// Desired resources are marked with the ManagedByAnnotation of the
+// AdvDeployment.
+func (r *Reconciler) ReconcileResource(ctx context.Context, log logr.Logger, desired runtime.Object, desiredState DesiredState) error {
+	opts, err := r.ReconcileOptions(desired)
+	if err != nil {
+		return err
+	}
+
+	if desiredState != DesiredStateAbsent {
+		obj, err := meta.Accessor(desired)
+		if err != nil {
+			return err
+		}
+		annotations := obj.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string, 1)
+		}
+		annotations[workloadv1beta1.ManagedByAnnotation] = r.Config.ManagedBy()
+		obj.SetAnnotations(annotations)
+	}
+
+	if ServerSideApply {
+		action, err := Apply(ctx, log, r.Mgr.GetClient(), r.Mgr.GetScheme(), desired, desiredState, opts, r.IsDryRun())
+		if err != nil {
+			return err
+		}
+
+		if r.IsDryRun() {
+			r.RecordDryRun(desired, action, "")
+		} else {
+			r.RecordAction(desired, action)
+		}
+		return nil
+	}
+
+	if r.IsDryRun() {
+		action, diff, err := DryRunReconcile(ctx, log, r.Mgr.GetClient(), desired, desiredState, opts)
+		if err != nil {
+			return err
+		}
+
+		r.RecordDryRun(desired, action, diff)
+		return nil
+	}
+
+	action, err := Reconcile(ctx, log, r.Mgr.GetClient(), desired, desiredState, opts)
+	if err != nil {
+		return err
+	}
+
+	r.RecordAction(desired, action)
+	return nil
+}
+
+// RecordAction records action on obj as a Normal event on the AdvDeployment
+func (r *Reconciler) RecordAction(obj runtime.Object, action Action) {
+	if action == ActionNone || r.Recorder == nil {
+		return
+	}
+
+	kind := kindOf(obj)
+
+	name, _ := meta.NewAccessor().Name(obj)
+	r.Recorder.Eventf(r.Config, corev1.EventTypeNormal, string(action), "%s %s %s", action, kind, name)
+}
+
+// RecordDryRun records the action a dry run would have done on obj, and the
+// summarized diff, as a Normal DryRun event on the AdvDeployment
+func (r *Reconciler) RecordDryRun(obj runtime.Object, action Action, diff string) {
+	if action == ActionNone || r.Recorder == nil {
+		return
 	}
+
+	kind := kindOf(obj)
+
+	name, _ := meta.NewAccessor().Name(obj)
+	message := fmt.Sprintf("Would have %s %s %s", strings.ToLower(string(action)), kind, name)
+	if diff != "" {
+		message += ": " + diff
+	}
+	r.Recorder.Event(r.Config, corev1.EventTypeNormal, "DryRun", message)
 }
 
-func Reconcile(log logr.Logger, c client.Client, desired runtime.Object, desiredState DesiredState) error {
+// Reconcile makes the live resource match desired and desiredState, and
+// returns what it had to do for that. Resources that cannot be updated in
+// place are replaced according to opts.RecreatePolicy, the opts.IgnoredFields
+// of the live resource are kept.
+func Reconcile(ctx context.Context, log logr.Logger, c client.Client, desired runtime.Object, desiredState DesiredState, opts ReconcileOptions) (Action, error) {
 	if desiredState == "" {
 		desiredState = DesiredStatePresent
 	}
 
 	desiredType := reflect.TypeOf(desired)
 	var current = desired.DeepCopyObject()
-	var desiredCopy = desired.DeepCopyObject()
 	key, err := client.ObjectKeyFromObject(current)
 	if err != nil {
-		return emperror.With(err, "kind", desiredType)
+		return ActionNone, emperror.With(err, "kind", desiredType)
 	}
 	log = log.WithValues("kind", desiredType, "name", key.Name)
 
-	err = c.Get(context.TODO(), key, current)
+	err = c.Get(ctx, key, current)
 	if err != nil && !apierrors.IsNotFound(err) {
-		return emperror.WrapWith(err, "getting resource failed", "kind", desiredType, "name", key.Name)
+		return ActionNone, emperror.WrapWith(err, "getting resource failed", "kind", desiredType, "name", key.Name)
 	}
 	if apierrors.IsNotFound(err) {
 		if desiredState == DesiredStatePresent {
 			if err := patch.DefaultAnnotator.SetLastAppliedAnnotation(desired); err != nil {
 				log.Error(err, "Failed to set last applied annotation", "desired", desired)
 			}
-			if err := c.Create(context.TODO(), desired); err != nil {
-				return emperror.WrapWith(err, "creating resource failed", "kind", desiredType, "name", key.Name)
+			if err := c.Create(ctx, desired); err != nil {
+				return ActionNone, emperror.WrapWith(err, "creating resource failed", "kind", desiredType, "name", key.Name)
 			}
 			log.Info("resource created")
+			return ActionCreated, nil
 		}
 	} else {
 		if desiredState == DesiredStatePresent {
-			patchResult, err := patch.DefaultPatchMaker.Calculate(current, desired)
+			if isDeleting(current) {
+				log.Info("resource is being deleted, waiting to create it again")
+				return ActionNone, nil
+			}
+
+			patchResult, err := patch.DefaultPatchMaker.Calculate(current, desired, patch.IgnoreFields(opts.IgnoredFields...))
 			if err != nil {
+				metrics.PatchFailures.WithLabelValues(desiredType.String()).Inc()
 				log.Error(err, "could not match objects", "kind", desiredType, "name", key.Name)
 			} else if patchResult.IsEmpty() {
 				log.V(1).Info("resource is in sync")
-				return nil
+				return ActionNone, nil
 			} else {
 				log.V(1).Info("resource diffs",
 					"patch", string(patchResult.Patch),
@@ -142,39 +508,189 @@ func Reconcile(log logr.Logger, c client.Client, desired runtime.Object, desired
 				log.Error(err, "Failed to set last applied annotation", "desired", desired)
 			}
 
-			metaAccessor := meta.NewAccessor()
-			currentResourceVersion, err := metaAccessor.ResourceVersion(current)
-			if err != nil {
-				return err
-			}
+			desiredCopy := desired.DeepCopyObject()
 
-			metaAccessor.SetResourceVersion(desired, currentResourceVersion)
-			prepareResourceForUpdate(current, desired)
+			// a conflict only means current is stale, the update is retried
+			// against a fresh copy
+			err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+				currentResourceVersion, err := meta.NewAccessor().ResourceVersion(current)
+				if err != nil {
+					return err
+				}
 
-			if err := c.Update(context.TODO(), desired); err != nil {
-				if apierrors.IsConflict(err) || apierrors.IsInvalid(err) {
-					log.Info("resource needs to be re-created", "error", err)
-					err := c.Delete(context.TODO(), current)
-					if err != nil {
-						return emperror.WrapWith(err, "could not delete resource", "kind", desiredType, "name", key.Name)
-					}
-					log.Info("resource deleted")
-					if err := c.Create(context.TODO(), desiredCopy); err != nil {
-						return emperror.WrapWith(err, "creating resource failed", "kind", desiredType, "name", key.Name)
-					}
-					log.Info("resource created")
-					return nil
+				meta.NewAccessor().SetResourceVersion(desired, currentResourceVersion)
+				prepareResourceForUpdate(current, desired)
+				if err := patch.PreserveFields(current, desired, opts.IgnoredFields); err != nil {
+					return err
 				}
 
-				return emperror.WrapWith(err, "updating resource failed", "kind", desiredType, "name", key.Name)
+				err = c.Update(ctx, desired)
+				if apierrors.IsConflict(err) {
+					log.V(1).Info("resource changed meanwhile, retrying", "error", err)
+					if err := c.Get(ctx, key, current); err != nil {
+						return err
+					}
+				}
+				return err
+			})
+			if apierrors.IsInvalid(err) {
+				return recreate(ctx, log, c, current, desiredCopy, opts.RecreatePolicy, err)
+			}
+			if err != nil {
+				return ActionNone, emperror.WrapWith(err, "updating resource failed", "kind", desiredType, "name", key.Name)
 			}
 			log.Info("resource updated")
+			return ActionUpdated, nil
 		} else if desiredState == DesiredStateAbsent {
-			if err := c.Delete(context.TODO(), current); err != nil {
-				return emperror.WrapWith(err, "deleting resource failed", "kind", desiredType, "name", key.Name)
+			if !opts.deletable(current) {
+				log.Info("resource is not controlled by the AdvDeployment, leaving it")
+				return ActionNone, nil
+			}
+			if err := c.Delete(ctx, current); err != nil {
+				return ActionNone, emperror.WrapWith(err, "deleting resource failed", "kind", desiredType, "name", key.Name)
 			}
 			log.Info("resource deleted")
+			return ActionDeleted, nil
 		}
 	}
-	return nil
+	return ActionNone, nil
+}
+
+// DryRunReconcile returns what Reconcile would do to make the live resource
+// match desired and desiredState, along with a summary of the changed fields.
+// Creates, updates and deletes are sent as server-side dry runs, so that
+// admission errors surface without changing anything.
+func DryRunReconcile(ctx context.Context, log logr.Logger, c client.Client, desired runtime.Object, desiredState DesiredState, opts ReconcileOptions) (Action, string, error) {
+	if desiredState == "" {
+		desiredState = DesiredStatePresent
+	}
+
+	desiredType := reflect.TypeOf(desired)
+	var current = desired.DeepCopyObject()
+	key, err := client.ObjectKeyFromObject(current)
+	if err != nil {
+		return ActionNone, "", emperror.With(err, "kind", desiredType)
+	}
+	log = log.WithValues("kind", desiredType, "name", key.Name, "dryRun", true)
+
+	err = c.Get(ctx, key, current)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return ActionNone, "", emperror.WrapWith(err, "getting resource failed", "kind", desiredType, "name", key.Name)
+	}
+	if apierrors.IsNotFound(err) {
+		if desiredState != DesiredStatePresent {
+			return ActionNone, "", nil
+		}
+
+		if err := patch.DefaultAnnotator.SetLastAppliedAnnotation(desired); err != nil {
+			log.Error(err, "Failed to set last applied annotation", "desired", desired)
+		}
+		if err := c.Create(ctx, desired, client.DryRunAll); err != nil {
+			return ActionNone, "", emperror.WrapWith(err, "dry run of creating resource failed", "kind", desiredType, "name", key.Name)
+		}
+		log.Info("resource would be created")
+		return ActionCreated, "", nil
+	}
+
+	if desiredState == DesiredStateAbsent {
+		if !opts.deletable(current) {
+			log.Info("resource is not controlled by the AdvDeployment, leaving it")
+			return ActionNone, "", nil
+		}
+		if err := c.Delete(ctx, current, client.DryRunAll); err != nil {
+			return ActionNone, "", emperror.WrapWith(err, "dry run of deleting resource failed", "kind", desiredType, "name", key.Name)
+		}
+		log.Info("resource would be deleted")
+		return ActionDeleted, "", nil
+	}
+
+	diff := "unknown changes"
+	patchResult, err := patch.DefaultPatchMaker.Calculate(current, desired, patch.IgnoreFields(opts.IgnoredFields...))
+	if err != nil {
+		metrics.PatchFailures.WithLabelValues(desiredType.String()).Inc()
+		log.Error(err, "could not match objects")
+	} else if patchResult.IsEmpty() {
+		log.V(1).Info("resource is in sync")
+		return ActionNone, "", nil
+	} else {
+		diff = SummarizePatch(patchResult.Patch)
+		log.V(1).Info("resource diffs", "patch", string(patchResult.Patch))
+	}
+
+	if err := patch.DefaultAnnotator.SetLastAppliedAnnotation(desired); err != nil {
+		log.Error(err, "Failed to set last applied annotation", "desired", desired)
+	}
+
+	metaAccessor := meta.NewAccessor()
+	currentResourceVersion, err := metaAccessor.ResourceVersion(current)
+	if err != nil {
+		return ActionNone, "", err
+	}
+
+	metaAccessor.SetResourceVersion(desired, currentResourceVersion)
+	prepareResourceForUpdate(current, desired)
+	if err := patch.PreserveFields(current, desired, opts.IgnoredFields); err != nil {
+		return ActionNone, "", err
+	}
+
+	if err := c.Update(ctx, desired, client.DryRunAll); err != nil {
+		if apierrors.IsInvalid(err) && checkRecreate(opts.RecreatePolicy, current, desired) == nil {
+			log.Info("resource would be re-created", "error", err, "policy", opts.RecreatePolicy)
+			return ActionRecreated, diff, nil
+		}
+
+		return ActionNone, "", emperror.WrapWith(err, "dry run of updating resource failed", "kind", desiredType, "name", key.Name)
+	}
+	log.Info("resource would be updated")
+	return ActionUpdated, diff, nil
+}
+
+const (
+	summaryDepth = 4
+	summaryPaths = 10
+)
+
+// SummarizePatch lists the fields a merge patch changes, nested fields are
+// cut at a few levels and long lists are truncated
+func SummarizePatch(p []byte) string {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(p, &fields); err != nil {
+		return "unknown changes"
+	}
+
+	paths := make(map[string]struct{})
+	var walk func(prefix string, depth int, fields map[string]interface{})
+	walk = func(prefix string, depth int, fields map[string]interface{}) {
+		for k, v := range fields {
+			// strategic merge patch directives
+			if strings.HasPrefix(k, "$") {
+				continue
+			}
+
+			path := k
+			if prefix != "" {
+				path = prefix + "." + k
+			}
+
+			nested, ok := v.(map[string]interface{})
+			if ok && depth < summaryDepth && len(nested) > 0 {
+				walk(path, depth+1, nested)
+				continue
+			}
+			paths[path] = struct{}{}
+		}
+	}
+	walk("", 1, fields)
+
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	if len(sorted) > summaryPaths {
+		more := len(sorted) - summaryPaths
+		sorted = append(sorted[:summaryPaths], fmt.Sprintf("and %d more", more))
+	}
+	return strings.Join(sorted, ", ")
 }
@@ -0,0 +1,193 @@
+package resources
+
+import (
+	"context"
+	"testing"
+
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	"github.com/xkcp0324/workload-controller/pkg/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSummarizePatch(t *testing.T) {
+	tests := []struct {
+		patch    string
+		expected string
+	}{
+		{
+			patch:    `{"spec":{"replicas":3}}`,
+			expected: "spec.replicas",
+		},
+		{
+			patch:    `{"metadata":{"labels":{"a":"b"}},"spec":{"template":{"spec":{"containers":[{"name":"app","image":"app:v2"}]}}},"$setElementOrder/ports":[]}`,
+			expected: "metadata.labels.a, spec.template.spec.containers",
+		},
+		{
+			patch:    `{"spec":{"template":{"metadata":{"labels":{"a":"b"}}}}}`,
+			expected: "spec.template.metadata.labels",
+		},
+		{
+			patch:    `{"a":1,"b":1,"c":1,"d":1,"e":1,"f":1,"g":1,"h":1,"i":1,"j":1,"k":1,"l":1}`,
+			expected: "a, b, c, d, e, f, g, h, i, j, and 2 more",
+		},
+		{
+			patch:    `not json`,
+			expected: "unknown changes",
+		},
+	}
+
+	for _, test := range tests {
+		if summary := SummarizePatch([]byte(test.patch)); summary != test.expected {
+			t.Errorf("Expected %q got %q for %s", test.expected, summary, test.patch)
+		}
+	}
+}
+
+func TestPrepareServiceForUpdate(t *testing.T) {
+	current := &corev1.Service{
+		Spec: corev1.ServiceSpec{
+			Type:                  corev1.ServiceTypeLoadBalancer,
+			ExternalTrafficPolicy: corev1.ServiceExternalTrafficPolicyTypeLocal,
+			ClusterIP:             "10.0.0.1",
+			HealthCheckNodePort:   31000,
+			Ports: []corev1.ServicePort{
+				{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP, NodePort: 30080},
+				{Name: "grpc", Port: 9090, Protocol: corev1.ProtocolTCP, NodePort: 30090},
+			},
+		},
+	}
+
+	desired := current.DeepCopy()
+	desired.Spec.ClusterIP = ""
+	desired.Spec.HealthCheckNodePort = 0
+	desired.Spec.Ports = []corev1.ServicePort{
+		{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP, TargetPort: intstr.FromInt(8081)},
+		{Name: "admin", Port: 9000, Protocol: corev1.ProtocolTCP},
+	}
+
+	prepareResourceForUpdate(current, desired)
+
+	if desired.Spec.ClusterIP != "10.0.0.1" {
+		t.Errorf("Expected clusterIP 10.0.0.1 got %q", desired.Spec.ClusterIP)
+	}
+	if desired.Spec.HealthCheckNodePort != 31000 {
+		t.Errorf("Expected healthCheckNodePort 31000 got %d", desired.Spec.HealthCheckNodePort)
+	}
+	if desired.Spec.Ports[0].NodePort != 30080 || desired.Spec.Ports[1].NodePort != 0 {
+		t.Errorf("Expected nodePorts 30080 and 0 got %d and %d", desired.Spec.Ports[0].NodePort, desired.Spec.Ports[1].NodePort)
+	}
+
+	desired.Spec.Type = corev1.ServiceTypeClusterIP
+	desired.Spec.HealthCheckNodePort = 0
+	desired.Spec.Ports[0].NodePort = 0
+	prepareResourceForUpdate(current, desired)
+	if desired.Spec.HealthCheckNodePort != 0 || desired.Spec.Ports[0].NodePort != 0 {
+		t.Errorf("Expected no node ports for a ClusterIP service, got %v", desired.Spec)
+	}
+}
+
+func TestReconcileOptionsIgnoredFieldsOfKind(t *testing.T) {
+	r := &Reconciler{Config: &workloadv1beta1.AdvDeployment{
+		Spec: workloadv1beta1.AdvDeploymentSpec{
+			IgnoredFields: []workloadv1beta1.IgnoredField{
+				{Kind: "Deployment", Path: "spec.replicas"},
+				{Path: "metadata.annotations[sidecar.istio.io/*]"},
+			},
+		},
+	}}
+
+	opts, err := r.ReconcileOptions(&appsv1.Deployment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opts.IgnoredFields) != 2 {
+		t.Errorf("Expected both fields to be ignored for Deployments, got %d", len(opts.IgnoredFields))
+	}
+
+	opts, err = r.ReconcileOptions(&corev1.Service{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opts.IgnoredFields) != 1 {
+		t.Errorf("Expected only the field of every kind to be ignored for Services, got %d", len(opts.IgnoredFields))
+	}
+}
+
+func TestReconcileOptionsLeavesDefaultIgnoredFields(t *testing.T) {
+	defaults := DefaultIgnoredFields
+	defer func() { DefaultIgnoredFields = defaults }()
+	DefaultIgnoredFields = make([]workloadv1beta1.IgnoredField, 1, 4)
+	DefaultIgnoredFields[0] = workloadv1beta1.IgnoredField{Path: "spec.replicas"}
+
+	r := &Reconciler{Config: &workloadv1beta1.AdvDeployment{}}
+	r.Config.Spec.IgnoredFields = []workloadv1beta1.IgnoredField{{Path: "metadata.labels"}}
+	if _, err := r.ReconcileOptions(&appsv1.Deployment{}); err != nil {
+		t.Fatal(err)
+	}
+	if spare := DefaultIgnoredFields[:2][1]; spare.Path != "" {
+		t.Errorf("Expected the spare capacity of the defaults to be left alone, got %+v", spare)
+	}
+}
+
+func TestGetTopologySpreadConstraints(t *testing.T) {
+	r := &Reconciler{Config: &workloadv1beta1.AdvDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}}
+	r.Config.Spec.TopologySpread = &workloadv1beta1.TopologySpreadStrategy{
+		TopologyKeys: []string{corev1.LabelHostname, corev1.LabelZoneFailureDomain},
+	}
+	base := []corev1.TopologySpreadConstraint{
+		{MaxSkew: 2, TopologyKey: corev1.LabelZoneFailureDomain, WhenUnsatisfiable: corev1.DoNotSchedule},
+	}
+
+	constraints := r.GetTopologySpreadConstraints("gz01b", base)
+	if len(constraints) != 2 || constraints[0].MaxSkew != 2 {
+		t.Fatalf("Expected the zone to be left to the template and the hostname to be added, got %+v", constraints)
+	}
+	generated := constraints[1]
+	if generated.TopologyKey != corev1.LabelHostname || generated.MaxSkew != 1 || generated.WhenUnsatisfiable != corev1.ScheduleAnyway {
+		t.Errorf("Expected a defaulted constraint on the hostname, got %+v", generated)
+	}
+	if release := generated.LabelSelector.MatchLabels[r.Config.GetLabelKeys().Release]; release != "app-gz01b" {
+		t.Errorf("Expected the constraint to select the pods of the cell, got %v", generated.LabelSelector.MatchLabels)
+	}
+	if len(base) != 1 {
+		t.Errorf("Expected base to be left alone, got %+v", base)
+	}
+}
+
+func TestReconcileAbsentLeavesForeignResources(t *testing.T) {
+	owner := &workloadv1beta1.AdvDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "owner-uid"}}
+	foreign := &autoscalingv1.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+	owned := &autoscalingv1.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{
+		Name:            "app-owned",
+		Namespace:       "default",
+		OwnerReferences: []metav1.OwnerReference{{Name: "app", UID: "owner-uid", Controller: utils.BoolPointer(true)}},
+	}}
+	c := fake.NewFakeClient(foreign.DeepCopy(), owned.DeepCopy())
+	opts := ReconcileOptions{Owner: owner}
+
+	action, err := Reconcile(context.TODO(), ctrl.Log, c, foreign.DeepCopy(), DesiredStateAbsent, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action != ActionNone {
+		t.Errorf("Expected the HPA not controlled by the AdvDeployment to be left alone, got %s", action)
+	}
+	if err := c.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "app"}, &autoscalingv1.HorizontalPodAutoscaler{}); err != nil {
+		t.Errorf("Expected the foreign HPA to still exist, got %v", err)
+	}
+
+	action, err = Reconcile(context.TODO(), ctrl.Log, c, owned.DeepCopy(), DesiredStateAbsent, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action != ActionDeleted {
+		t.Errorf("Expected the HPA controlled by the AdvDeployment to be deleted, got %s", action)
+	}
+}
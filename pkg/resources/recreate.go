@@ -0,0 +1,107 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	"github.com/goph/emperror"
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	"github.com/xkcp0324/workload-controller/pkg/metrics"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// recreate replaces current, which cannot be updated to desired in place
+// because of cause, according to policy. With the default Orphan policy the
+// pods of the resource keep running and are adopted by the new one, it is
+// refused when the new selector would not adopt them. The resource is only
+// created again once the deletion completed, by a later reconcile when it
+// lingers for its dependents.
+func recreate(ctx context.Context, log logr.Logger, c client.Client, current, desired runtime.Object, policy workloadv1beta1.RecreatePolicyType, cause error, opts ...client.CreateOption) (Action, error) {
+	desiredType := reflect.TypeOf(desired)
+	key, err := client.ObjectKeyFromObject(desired)
+	if err != nil {
+		return ActionNone, emperror.With(err, "kind", desiredType)
+	}
+
+	if err := checkRecreate(policy, current, desired); err != nil {
+		return ActionNone, emperror.WrapWith(cause, "resource cannot be updated in place and "+err.Error(),
+			"kind", desiredType, "name", key.Name)
+	}
+	propagation := metav1.DeletePropagationOrphan
+	if policy == workloadv1beta1.DeleteRecreatePolicy {
+		propagation = metav1.DeletePropagationBackground
+	}
+
+	log.Info("resource needs to be re-created", "error", cause, "policy", policy)
+	metrics.RecreateFallbacks.WithLabelValues(desiredType.String()).Inc()
+
+	err = c.Delete(ctx, current, client.PropagationPolicy(propagation))
+	if err != nil && !apierrors.IsNotFound(err) {
+		return ActionNone, emperror.WrapWith(err, "could not delete resource", "kind", desiredType, "name", key.Name)
+	}
+	log.Info("resource deleted", "propagation", propagation)
+
+	// the resource lingers until the garbage collector released its dependents,
+	// it is created again by the next reconcile rather than blocking this one
+	err = c.Get(ctx, key, current.DeepCopyObject())
+	if err == nil {
+		log.Info("resource is being deleted, waiting to create it again")
+		return ActionDeleted, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return ActionDeleted, emperror.WrapWith(err, "getting resource failed", "kind", desiredType, "name", key.Name)
+	}
+
+	meta.NewAccessor().SetResourceVersion(desired, "")
+	if err := c.Create(ctx, desired, opts...); err != nil {
+		return ActionDeleted, emperror.WrapWith(err, "creating resource failed", "kind", desiredType, "name", key.Name)
+	}
+	log.Info("resource created")
+	return ActionRecreated, nil
+}
+
+// isDeleting tells whether obj is waiting for its finalizers, to be created
+// again once it is gone
+func isDeleting(obj runtime.Object) bool {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return false
+	}
+	return accessor.GetDeletionTimestamp() != nil
+}
+
+// checkRecreate tells why policy does not allow current to be replaced by
+// desired, if it does not
+func checkRecreate(policy workloadv1beta1.RecreatePolicyType, current, desired runtime.Object) error {
+	switch policy {
+	case workloadv1beta1.NeverRecreatePolicy:
+		return errors.New("the recreate policy is Never")
+	case workloadv1beta1.DeleteRecreatePolicy:
+		return nil
+	}
+	if !reflect.DeepEqual(podSelector(current), podSelector(desired)) {
+		return errors.New("the Orphan recreate policy would leave the pods of the changed selector running, use the Delete recreate policy")
+	}
+	return nil
+}
+
+// podSelector returns the selector of the pods owned by obj, nil for the kinds
+// without pods
+func podSelector(obj runtime.Object) *metav1.LabelSelector {
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		return o.Spec.Selector
+	case *appsv1.StatefulSet:
+		return o.Spec.Selector
+	case *appsv1.DaemonSet:
+		return o.Spec.Selector
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func TestRecreate(t *testing.T) {
+	current := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-cell", Namespace: "default", Labels: map[string]string{"version": "1"}},
+	}
+	desired := current.DeepCopy()
+	desired.Labels["version"] = "2"
+	cause := errors.New("field is immutable")
+
+	c := fake.NewFakeClient(current.DeepCopy())
+	action, err := recreate(context.TODO(), zap.Logger(true), c, current.DeepCopy(), desired.DeepCopy(), workloadv1beta1.NeverRecreatePolicy, cause)
+	if err == nil || action != ActionNone {
+		t.Fatalf("Expected the Never policy to fail without action, got %q, %v", action, err)
+	}
+
+	reselected := desired.DeepCopy()
+	reselected.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"version": "2"}}
+	action, err = recreate(context.TODO(), zap.Logger(true), c, current.DeepCopy(), reselected, workloadv1beta1.OrphanRecreatePolicy, cause)
+	if err == nil || action != ActionNone {
+		t.Fatalf("Expected the Orphan policy to refuse a changed selector, got %q, %v", action, err)
+	}
+
+	action, err = recreate(context.TODO(), zap.Logger(true), c, current.DeepCopy(), desired.DeepCopy(), workloadv1beta1.OrphanRecreatePolicy, cause)
+	if err != nil || action != ActionRecreated {
+		t.Fatalf("Expected the resource to be recreated, got %q, %v", action, err)
+	}
+
+	live := &appsv1.Deployment{}
+	err = c.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "app-cell"}, live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if live.Labels["version"] != "2" {
+		t.Errorf("Expected the recreated resource to match desired, got labels %v", live.Labels)
+	}
+}
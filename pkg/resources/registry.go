@@ -0,0 +1,161 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/goph/emperror"
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// Component is a ComponentReconciler registered with Register
+type Component struct {
+	// Name identifies the component, it reports the condition <Name>Reconciled
+	Name string
+	// After names the components reconciled before this one, it is skipped
+	// as long as one of them fails
+	After []string
+	// Enabled tells whether the component applies to the AdvDeployment, it
+	// always does without it. Disabled components implementing
+	// ComponentCleaner are cleaned up instead.
+	Enabled func(config *workloadv1beta1.AdvDeployment) bool
+	New     func(mgr manager.Manager, recorder record.EventRecorder, config *workloadv1beta1.AdvDeployment) ComponentReconciler
+}
+
+// ComponentCleaner removes what a component left behind once it is disabled
+type ComponentCleaner interface {
+	Cleanup(ctx context.Context, log logr.Logger) error
+}
+
+// ConditionType returns the type of the condition the component reports
+func (c Component) ConditionType() workloadv1beta1.AdvDeploymentConditionType {
+	return workloadv1beta1.AdvDeploymentConditionType(strings.Title(c.Name) + "Reconciled")
+}
+
+var registry struct {
+	sync.Mutex
+	components []Component
+}
+
+// Register adds a component, usually from the init of its package
+func Register(c Component) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	for _, registered := range registry.components {
+		if registered.Name == c.Name {
+			panic(fmt.Sprintf("component %s registered twice", c.Name))
+		}
+	}
+	registry.components = append(registry.components, c)
+}
+
+// Components returns the registered components, every one after those it
+// depends on and otherwise in registration order
+func Components() ([]Component, error) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	names := make(map[string]bool, len(registry.components))
+	for _, c := range registry.components {
+		names[c.Name] = true
+	}
+	for _, c := range registry.components {
+		for _, dep := range c.After {
+			if !names[dep] {
+				return nil, fmt.Errorf("component %s depends on unknown component %s", c.Name, dep)
+			}
+		}
+	}
+
+	ordered := make([]Component, 0, len(registry.components))
+	done := make(map[string]bool, len(registry.components))
+	for len(ordered) < len(registry.components) {
+		progress := false
+		for _, c := range registry.components {
+			if done[c.Name] || !allDone(c.After, done) {
+				continue
+			}
+			ordered = append(ordered, c)
+			done[c.Name] = true
+			progress = true
+			break
+		}
+		if !progress {
+			return nil, fmt.Errorf("components depend on each other in a cycle")
+		}
+	}
+	return ordered, nil
+}
+
+func allDone(names []string, done map[string]bool) bool {
+	for _, name := range names {
+		if !done[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// ComponentResult is the outcome of reconciling one component
+type ComponentResult struct {
+	Component Component
+	Enabled   bool
+	Err       error
+	// BlockedBy names the failed dependency the component was skipped for
+	BlockedBy string
+}
+
+// ReconcileComponents reconciles every registered component in order, a
+// failing component only holds back those depending on it. The returned error
+// aggregates the failures.
+func ReconcileComponents(ctx context.Context, log logr.Logger, mgr manager.Manager, recorder record.EventRecorder, config *workloadv1beta1.AdvDeployment) ([]ComponentResult, error) {
+	components, err := Components()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ComponentResult, 0, len(components))
+	failed := make(map[string]bool)
+	var errs []error
+	for _, c := range components {
+		result := ComponentResult{
+			Component: c,
+			Enabled:   c.Enabled == nil || c.Enabled(config),
+		}
+
+		for _, dep := range c.After {
+			if failed[dep] {
+				result.BlockedBy = dep
+				break
+			}
+		}
+
+		rec := c.New(mgr, recorder, config)
+		switch {
+		case result.BlockedBy != "":
+			failed[c.Name] = true
+			log.Info("component skipped", "component", c.Name, "blockedBy", result.BlockedBy)
+		case result.Enabled:
+			result.Err = rec.Reconcile(ctx, log)
+		default:
+			if cleaner, ok := rec.(ComponentCleaner); ok {
+				result.Err = cleaner.Cleanup(ctx, log)
+			}
+		}
+
+		if result.Err != nil {
+			failed[c.Name] = true
+			errs = append(errs, emperror.Wrap(result.Err, c.Name))
+		}
+		results = append(results, result)
+	}
+
+	return results, utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,92 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+type fakeComponent struct {
+	name  string
+	err   error
+	calls *[]string
+}
+
+func (f *fakeComponent) Reconcile(ctx context.Context, log logr.Logger) error {
+	*f.calls = append(*f.calls, f.name)
+	return f.err
+}
+
+type fakeCleaner struct {
+	fakeComponent
+}
+
+func (f *fakeCleaner) Cleanup(ctx context.Context, log logr.Logger) error {
+	*f.calls = append(*f.calls, "cleanup "+f.name)
+	return nil
+}
+
+func TestReconcileComponents(t *testing.T) {
+	registry.Lock()
+	saved := registry.components
+	registry.components = nil
+	registry.Unlock()
+	defer func() {
+		registry.Lock()
+		registry.components = saved
+		registry.Unlock()
+	}()
+
+	var calls []string
+	register := func(name string, after []string, enabled bool, err error) {
+		c := Component{
+			Name:  name,
+			After: after,
+			New: func(manager.Manager, record.EventRecorder, *workloadv1beta1.AdvDeployment) ComponentReconciler {
+				if !enabled {
+					return &fakeCleaner{fakeComponent{name: name, calls: &calls}}
+				}
+				return &fakeComponent{name: name, err: err, calls: &calls}
+			},
+		}
+		if !enabled {
+			c.Enabled = func(*workloadv1beta1.AdvDeployment) bool { return false }
+		}
+		Register(c)
+	}
+
+	register("ingress", []string{"svc"}, true, nil)
+	register("svc", nil, true, errors.New("port taken"))
+	register("deploy", nil, true, nil)
+	register("hpa", []string{"deploy"}, false, nil)
+
+	results, err := ReconcileComponents(context.TODO(), zap.Logger(true), nil, nil, &workloadv1beta1.AdvDeployment{})
+	if err == nil {
+		t.Fatal("Expected the svc failure to be returned")
+	}
+
+	expected := []string{"svc", "deploy", "cleanup hpa"}
+	if len(calls) != len(expected) {
+		t.Fatalf("Expected calls %v got %v", expected, calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Fatalf("Expected calls %v got %v", expected, calls)
+		}
+	}
+
+	for _, result := range results {
+		if result.Component.Name == "ingress" && result.BlockedBy != "svc" {
+			t.Errorf("Expected ingress to be blocked by svc, got %q", result.BlockedBy)
+		}
+		if result.Component.Name == "svc" && result.Component.ConditionType() != "SvcReconciled" {
+			t.Errorf("Expected condition SvcReconciled got %s", result.Component.ConditionType())
+		}
+	}
+}
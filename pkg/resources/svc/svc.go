@@ -6,12 +6,12 @@ import (
 	"github.com/goph/emperror"
 	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
 	"github.com/xkcp0324/workload-controller/pkg/resources"
-	"github.com/xkcp0324/workload-controller/pkg/utils"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
@@ -20,17 +20,30 @@ const (
 	componentName = "svc"
 )
 
+// TargetPort is the container port the Service forwards to
+var TargetPort = 8080
+
+func init() {
+	resources.Register(resources.Component{
+		Name: componentName,
+		New: func(mgr manager.Manager, recorder record.EventRecorder, config *workloadv1beta1.AdvDeployment) resources.ComponentReconciler {
+			return New(mgr, recorder, config, TargetPort)
+		},
+	})
+}
+
 type Reconciler struct {
 	resources.Reconciler
 	// other
 	port int
 }
 
-func New(mgr manager.Manager, config *workloadv1beta1.AdvDeployment, port int) *Reconciler {
+func New(mgr manager.Manager, recorder record.EventRecorder, config *workloadv1beta1.AdvDeployment, port int) *Reconciler {
 	return &Reconciler{
 		Reconciler: resources.Reconciler{
-			Mgr:    mgr,
-			Config: config,
+			Mgr:      mgr,
+			Recorder: recorder,
+			Config:   config,
 		},
 		port: port,
 	}
@@ -53,7 +66,7 @@ func (r *Reconciler) Service() runtime.Object {
 				},
 			},
 			Selector: map[string]string{
-				utils.ObserveMustLabelAppName: r.Config.Name,
+				r.Config.GetLabelKeys().App: r.Config.Name,
 			},
 		},
 	}
@@ -66,7 +79,7 @@ func (r *Reconciler) Deployment() runtime.Object {
 	return &appsv1.Deployment{}
 }
 
-func (r *Reconciler) Reconcile(log logr.Logger) error {
+func (r *Reconciler) Reconcile(ctx context.Context, log logr.Logger) error {
 	log = log.WithValues("component", componentName)
 
 	for _, res := range []resources.Resource{
@@ -74,13 +87,9 @@ func (r *Reconciler) Reconcile(log logr.Logger) error {
 		// r.Deployment,
 	} {
 		o := res()
-		result, err := controllerutil.CreateOrUpdate(context.TODO(), r.Mgr.GetClient(), o, func() error {
-			return nil
-		})
+		err := r.ReconcileResource(ctx, log, o, resources.DesiredStatePresent)
 		if err != nil {
-			return emperror.WrapWith(err, "failed to reconcile resource",
-				"resource", o.GetObjectKind().GroupVersionKind(),
-				"result", result)
+			return emperror.WrapWith(err, "failed to reconcile resource", "resource", o.GetObjectKind().GroupVersionKind())
 		}
 	}
 	log.Info("Reconciled")
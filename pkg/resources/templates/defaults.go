@@ -21,6 +21,7 @@ func GetResourcesRequirementsOrDefault(requirements *corev1.ResourceRequirements
 
 func DefaultRollingUpdateStrategy() appsv1.DeploymentStrategy {
 	return appsv1.DeploymentStrategy{
+		Type: appsv1.RollingUpdateDeploymentStrategyType,
 		RollingUpdate: &appsv1.RollingUpdateDeployment{
 			MaxSurge:       utils.IntstrPointer(1),
 			MaxUnavailable: utils.IntstrPointer(0),
@@ -34,6 +35,27 @@ func DefaultRecreateStrategy() appsv1.DeploymentStrategy {
 	}
 }
 
+// DeploymentStrategy returns the strategy of the child Deployments, RollingUpdate
+// with DefaultRollingUpdateStrategy values unless told otherwise
+func DeploymentStrategy(strategy *workloadv1beta1.DeploymentStrategy) appsv1.DeploymentStrategy {
+	if strategy != nil && strategy.Type == appsv1.RecreateDeploymentStrategyType {
+		return DefaultRecreateStrategy()
+	}
+
+	s := DefaultRollingUpdateStrategy()
+	if strategy == nil {
+		return s
+	}
+
+	if strategy.MaxSurge != nil {
+		s.RollingUpdate.MaxSurge = strategy.MaxSurge
+	}
+	if strategy.MaxUnavailable != nil {
+		s.RollingUpdate.MaxUnavailable = strategy.MaxUnavailable
+	}
+	return s
+}
+
 func AppEnv(config *workloadv1beta1.AdvDeployment) []corev1.EnvVar {
 	envs := []corev1.EnvVar{
 		{
@@ -0,0 +1,129 @@
+package traffic
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// These tests run the component against an API server with the Istio CRDs of
+// testdata installed, the manager is not started as the istio objects are
+// read without cache.
+
+var mgr manager.Manager
+var testEnv *envtest.Environment
+
+func TestTraffic(t *testing.T) {
+	RegisterFailHandler(Fail)
+
+	RunSpecsWithDefaultAndCustomReporters(t,
+		"Traffic Suite",
+		[]Reporter{envtest.NewlineReporter{}})
+}
+
+var _ = BeforeSuite(func(done Done) {
+	logf.SetLogger(zap.LoggerTo(GinkgoWriter, true))
+
+	By("bootstrapping test environment")
+	testEnv = &envtest.Environment{
+		CRDDirectoryPaths: []string{filepath.Join("testdata", "crds")},
+	}
+
+	cfg, err := testEnv.Start()
+	Expect(err).ToNot(HaveOccurred())
+	Expect(cfg).ToNot(BeNil())
+
+	err = workloadv1beta1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
+
+	mgr, err = manager.New(cfg, manager.Options{Scheme: scheme.Scheme, MetricsBindAddress: "0"})
+	Expect(err).ToNot(HaveOccurred())
+
+	close(done)
+}, 60)
+
+var _ = AfterSuite(func() {
+	By("tearing down the test environment")
+	err := testEnv.Stop()
+	Expect(err).ToNot(HaveOccurred())
+})
+
+var _ = Describe("Traffic", func() {
+	ctx := context.TODO()
+	key := types.NamespacedName{Namespace: "default", Name: "app"}
+
+	get := func(gvk schema.GroupVersionKind) (*unstructured.Unstructured, error) {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+		return obj, mgr.GetClient().Get(ctx, key, obj)
+	}
+
+	weights := func() []int64 {
+		vs, err := get(VirtualServiceGVK)
+		Expect(err).ToNot(HaveOccurred())
+		http, _, _ := unstructured.NestedSlice(vs.Object, "spec", "http")
+		Expect(http).To(HaveLen(1))
+		routes, _, _ := unstructured.NestedSlice(http[0].(map[string]interface{}), "route")
+
+		var weights []int64
+		for _, route := range routes {
+			weight, _, _ := unstructured.NestedInt64(route.(map[string]interface{}), "weight")
+			weights = append(weights, weight)
+		}
+		return weights
+	}
+
+	It("shifts the traffic with the rollout and cleans up", func() {
+		advDeploy := &workloadv1beta1.AdvDeployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name, UID: "uid"},
+		}
+		advDeploy.Spec.ServiceName = "app"
+		advDeploy.Spec.Traffic = &workloadv1beta1.TrafficStrategy{}
+		advDeploy.Spec.Strategy.UpgradeType = workloadv1beta1.BetaUpgradeType
+		advDeploy.Spec.Strategy.CellReplicas = []*workloadv1beta1.CellReplicas{
+			{CellName: "beta", Replicas: 1},
+			{CellName: "stable", Replicas: 9},
+		}
+
+		By("keeping the beta cell out until it has available pods")
+		Expect(New(mgr, record.NewFakeRecorder(10), advDeploy).Reconcile(ctx, logf.Log)).To(Succeed())
+		Expect(weights()).To(Equal([]int64{0, 100}))
+
+		dr, err := get(DestinationRuleGVK)
+		Expect(err).ToNot(HaveOccurred())
+		subsets, _, _ := unstructured.NestedSlice(dr.Object, "spec", "subsets")
+		Expect(subsets).To(HaveLen(2))
+
+		By("sending the beta cell its share once available")
+		advDeploy.Status.PodSets = map[string]workloadv1beta1.PodSetStatus{
+			"app-beta":   {AvailableReplicas: 1},
+			"app-stable": {AvailableReplicas: 9},
+		}
+		Expect(New(mgr, record.NewFakeRecorder(10), advDeploy).Reconcile(ctx, logf.Log)).To(Succeed())
+		Expect(weights()).To(Equal([]int64{10, 90}))
+
+		By("deleting the istio objects once the traffic strategy is removed")
+		advDeploy.Spec.Traffic = nil
+		Expect(New(mgr, record.NewFakeRecorder(10), advDeploy).Cleanup(ctx, logf.Log)).To(Succeed())
+		for _, gvk := range []schema.GroupVersionKind{VirtualServiceGVK, DestinationRuleGVK} {
+			_, err := get(gvk)
+			Expect(apierrors.IsNotFound(err)).To(BeTrue(), "expected %s to be deleted, got %v", gvk.Kind, err)
+		}
+	})
+})
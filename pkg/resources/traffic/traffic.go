@@ -0,0 +1,237 @@
+package traffic
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/goph/emperror"
+	"github.com/pkg/errors"
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	"github.com/xkcp0324/workload-controller/pkg/resources"
+	"github.com/xkcp0324/workload-controller/pkg/utils"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+const (
+	componentName = "traffic"
+)
+
+var (
+	// istio types are handled as unstructured objects, so that the controller
+	// neither depends on the istio api nor requires istio to be installed
+	DestinationRuleGVK = schema.GroupVersionKind{Group: "networking.istio.io", Version: "v1alpha3", Kind: "DestinationRule"}
+	VirtualServiceGVK  = schema.GroupVersionKind{Group: "networking.istio.io", Version: "v1alpha3", Kind: "VirtualService"}
+)
+
+func init() {
+	resources.Register(resources.Component{
+		Name:    componentName,
+		After:   []string{"svc", "deploy"},
+		Enabled: func(config *workloadv1beta1.AdvDeployment) bool { return config.Spec.Traffic != nil },
+		New: func(mgr manager.Manager, recorder record.EventRecorder, config *workloadv1beta1.AdvDeployment) resources.ComponentReconciler {
+			return New(mgr, recorder, config)
+		},
+	})
+}
+
+type Reconciler struct {
+	resources.Reconciler
+}
+
+func New(mgr manager.Manager, recorder record.EventRecorder, config *workloadv1beta1.AdvDeployment) *Reconciler {
+	return &Reconciler{
+		Reconciler: resources.Reconciler{
+			Mgr:      mgr,
+			Recorder: recorder,
+			Config:   config,
+		},
+	}
+}
+
+// Weights returns the traffic weight of every cell of advDeploy, adding up to
+// 100. Explicit cell weights win, otherwise the cells
+// serving traffic share it by desired replicas, which cells serve follows the
+// Strategy.UpgradeType and the rollout:
+//   - Beta: the first cell is the beta cell, it serves once it has available
+//     pods, e.g. 10/90 for 1 and 9 replicas, and stops once its rollout is aborted
+//   - BlueGreen: the last cell is the green cell, it serves alone once it is
+//     rolled out, 0/100, and not at all before
+//   - otherwise every cell serves
+func Weights(advDeploy *workloadv1beta1.AdvDeployment) []int32 {
+	cells := advDeploy.Spec.Strategy.CellReplicas
+	weights := make([]int32, len(cells))
+	for _, cell := range cells {
+		if cell.Weight != nil {
+			for i, c := range cells {
+				weights[i] = utils.PointerToInt32(c.Weight)
+			}
+			return weights
+		}
+	}
+	if len(cells) == 0 {
+		return weights
+	}
+
+	// the cells in [from, to) serve the traffic
+	from, to := 0, len(cells)
+	switch advDeploy.Spec.Strategy.UpgradeType {
+	case workloadv1beta1.BetaUpgradeType:
+		if len(cells) > 1 && !available(advDeploy, cells[0]) {
+			from = 1
+		}
+	case workloadv1beta1.BlueGreenUpgradeType:
+		switch {
+		case rolledOut(advDeploy, cells[to-1]):
+			from = to - 1
+		case len(cells) > 1:
+			to--
+		}
+	}
+
+	shares := make([]int32, to-from)
+	for i, cell := range cells[from:to] {
+		shares[i] = cell.Replicas
+	}
+	copy(weights[from:to], utils.Distribute(100, shares))
+	return weights
+}
+
+// available tells whether the Deployment of cell has available pods and its
+// rollout is not aborted
+func available(advDeploy *workloadv1beta1.AdvDeployment, cell *workloadv1beta1.CellReplicas) bool {
+	name := advDeploy.Name + "-" + cell.CellName
+	return advDeploy.Status.PodSets[name].AvailableReplicas > 0 && !aborted(advDeploy, name)
+}
+
+// rolledOut tells whether every desired pod of the Deployment of cell is
+// updated and available, and its rollout is not aborted
+func rolledOut(advDeploy *workloadv1beta1.AdvDeployment, cell *workloadv1beta1.CellReplicas) bool {
+	name := advDeploy.Name + "-" + cell.CellName
+	podSet := advDeploy.Status.PodSets[name]
+	return cell.Replicas > 0 && podSet.UpdatedReplicas >= cell.Replicas && podSet.AvailableReplicas >= cell.Replicas &&
+		!aborted(advDeploy, name)
+}
+
+func aborted(advDeploy *workloadv1beta1.AdvDeployment, deployment string) bool {
+	for _, rollout := range advDeploy.Status.AbortedRollouts {
+		if rollout.Deployment == deployment {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reconciler) host() string {
+	return r.Config.Spec.ServiceName
+}
+
+func (r *Reconciler) newObject(gvk schema.GroupVersionKind, spec map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": spec,
+		},
+	}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetName(r.Config.Name)
+	obj.SetNamespace(r.Config.Namespace)
+	obj.SetLabels(r.GetSvcLabels())
+
+	_ = controllerutil.SetControllerReference(r.Config, obj, r.Mgr.GetScheme())
+	return obj
+}
+
+// DestinationRule has one subset per cell, selecting the pods of the cell
+func (r *Reconciler) DestinationRule() runtime.Object {
+	var subsets []interface{}
+	for _, cell := range r.Config.Spec.Strategy.CellReplicas {
+		subsets = append(subsets, map[string]interface{}{
+			"name": cell.CellName,
+			"labels": map[string]interface{}{
+				r.Config.GetLabelKeys().Release: r.Config.Name + "-" + cell.CellName,
+			},
+		})
+	}
+
+	return r.newObject(DestinationRuleGVK, map[string]interface{}{
+		"host":    r.host(),
+		"subsets": subsets,
+	})
+}
+
+// VirtualService routes the traffic to the cell subsets according to Weights
+func (r *Reconciler) VirtualService() runtime.Object {
+	cells := r.Config.Spec.Strategy.CellReplicas
+	weights := Weights(r.Config)
+
+	var routes []interface{}
+	for i, cell := range cells {
+		routes = append(routes, map[string]interface{}{
+			"destination": map[string]interface{}{
+				"host":   r.host(),
+				"subset": cell.CellName,
+			},
+			"weight": int64(weights[i]),
+		})
+	}
+
+	hosts := r.Config.Spec.Traffic.Hosts
+	if len(hosts) == 0 {
+		hosts = []string{r.host()}
+	}
+
+	spec := map[string]interface{}{
+		"hosts": utils.EmptyTypedStrSlice(hosts...),
+		"http": []interface{}{
+			map[string]interface{}{
+				"route": routes,
+			},
+		},
+	}
+	if len(r.Config.Spec.Traffic.Gateways) > 0 {
+		spec["gateways"] = utils.EmptyTypedStrSlice(r.Config.Spec.Traffic.Gateways...)
+	}
+
+	return r.newObject(VirtualServiceGVK, spec)
+}
+
+func (r *Reconciler) Reconcile(ctx context.Context, log logr.Logger) error {
+	log = log.WithValues("component", componentName)
+
+	if r.Config.Spec.Traffic == nil {
+		// clean up what may be left from an earlier traffic strategy, without
+		// failing when istio is not installed at all
+		for _, gvk := range []schema.GroupVersionKind{VirtualServiceGVK, DestinationRuleGVK} {
+			obj := r.newObject(gvk, nil)
+			err := r.ReconcileResource(ctx, log, obj, resources.DesiredStateAbsent)
+			if err != nil && !meta.IsNoMatchError(errors.Cause(err)) {
+				return emperror.WrapWith(err, "failed to reconcile resource", "resource", gvk)
+			}
+		}
+		return nil
+	}
+
+	for _, res := range []resources.Resource{
+		r.DestinationRule,
+		r.VirtualService,
+	} {
+		o := res()
+		err := r.ReconcileResource(ctx, log, o, resources.DesiredStatePresent)
+		if err != nil {
+			return emperror.WrapWith(err, "failed to reconcile resource", "resource", o.GetObjectKind().GroupVersionKind())
+		}
+	}
+
+	log.Info("Reconciled")
+	return nil
+}
+
+// Cleanup deletes the VirtualService and DestinationRule once Spec.Traffic is
+// removed, the cells go back to sharing the Service evenly
+func (r *Reconciler) Cleanup(ctx context.Context, log logr.Logger) error {
+	return r.Reconcile(ctx, log)
+}
@@ -0,0 +1,131 @@
+package traffic
+
+import (
+	"reflect"
+	"testing"
+
+	workloadv1beta1 "github.com/xkcp0324/workload-controller/pkg/apis/workload/v1beta1"
+	"github.com/xkcp0324/workload-controller/pkg/utils"
+)
+
+func TestWeights(t *testing.T) {
+	canary := []*workloadv1beta1.CellReplicas{
+		{CellName: "beta", Replicas: 1},
+		{CellName: "stable", Replicas: 9},
+	}
+	blueGreen := []*workloadv1beta1.CellReplicas{
+		{CellName: "blue", Replicas: 3},
+		{CellName: "green", Replicas: 3},
+	}
+
+	tests := []struct {
+		name        string
+		upgradeType string
+		cells       []*workloadv1beta1.CellReplicas
+		podSets     map[string]workloadv1beta1.PodSetStatus
+		aborted     string
+		expected    []int32
+	}{
+		{
+			name:     "cells share by desired replicas, whatever is ready",
+			cells:    canary,
+			podSets:  map[string]workloadv1beta1.PodSetStatus{"beta": {AvailableReplicas: 1}, "stable": {AvailableReplicas: 3}},
+			expected: []int32{10, 90},
+		},
+		{
+			name:        "beta cell without available pods gets nothing",
+			upgradeType: workloadv1beta1.BetaUpgradeType,
+			cells:       canary,
+			podSets:     map[string]workloadv1beta1.PodSetStatus{"stable": {AvailableReplicas: 9}},
+			expected:    []int32{0, 100},
+		},
+		{
+			name:        "beta cell gets its share once available",
+			upgradeType: workloadv1beta1.BetaUpgradeType,
+			cells:       canary,
+			podSets:     map[string]workloadv1beta1.PodSetStatus{"beta": {AvailableReplicas: 1}, "stable": {AvailableReplicas: 9}},
+			expected:    []int32{10, 90},
+		},
+		{
+			name:        "aborted beta cell gets nothing",
+			upgradeType: workloadv1beta1.BetaUpgradeType,
+			cells:       canary,
+			podSets:     map[string]workloadv1beta1.PodSetStatus{"beta": {AvailableReplicas: 1}, "stable": {AvailableReplicas: 9}},
+			aborted:     "beta",
+			expected:    []int32{0, 100},
+		},
+		{
+			name:        "blue green stays on blue while green rolls out",
+			upgradeType: workloadv1beta1.BlueGreenUpgradeType,
+			cells:       blueGreen,
+			podSets:     map[string]workloadv1beta1.PodSetStatus{"green": {UpdatedReplicas: 3, AvailableReplicas: 2}},
+			expected:    []int32{100, 0},
+		},
+		{
+			name:        "blue green switches once green is rolled out",
+			upgradeType: workloadv1beta1.BlueGreenUpgradeType,
+			cells:       blueGreen,
+			podSets:     map[string]workloadv1beta1.PodSetStatus{"green": {UpdatedReplicas: 3, AvailableReplicas: 3}},
+			expected:    []int32{0, 100},
+		},
+		{
+			name:        "blue green stays on blue once green is aborted",
+			upgradeType: workloadv1beta1.BlueGreenUpgradeType,
+			cells:       blueGreen,
+			podSets:     map[string]workloadv1beta1.PodSetStatus{"green": {UpdatedReplicas: 3, AvailableReplicas: 3}},
+			aborted:     "green",
+			expected:    []int32{100, 0},
+		},
+		{
+			name: "blue green switch with explicit weights",
+			cells: []*workloadv1beta1.CellReplicas{
+				{CellName: "blue", Replicas: 3, Weight: utils.IntPointer(0)},
+				{CellName: "green", Replicas: 3, Weight: utils.IntPointer(100)},
+			},
+			expected: []int32{0, 100},
+		},
+		{
+			name: "cells without a weight get no traffic",
+			cells: []*workloadv1beta1.CellReplicas{
+				{CellName: "a", Replicas: 1},
+				{CellName: "b", Replicas: 1, Weight: utils.IntPointer(100)},
+			},
+			expected: []int32{0, 100},
+		},
+		{
+			name: "rounded weights add up to 100",
+			cells: []*workloadv1beta1.CellReplicas{
+				{CellName: "a", Replicas: 1},
+				{CellName: "b", Replicas: 1},
+				{CellName: "c", Replicas: 1},
+			},
+			expected: []int32{34, 33, 33},
+		},
+		{
+			name: "cells without replicas share evenly",
+			cells: []*workloadv1beta1.CellReplicas{
+				{CellName: "a"},
+				{CellName: "b"},
+			},
+			expected: []int32{50, 50},
+		},
+	}
+
+	for _, tt := range tests {
+		advDeploy := &workloadv1beta1.AdvDeployment{}
+		advDeploy.Name = "app"
+		advDeploy.Spec.Strategy.UpgradeType = tt.upgradeType
+		advDeploy.Spec.Strategy.CellReplicas = tt.cells
+		advDeploy.Status.PodSets = map[string]workloadv1beta1.PodSetStatus{}
+		for cell, podSet := range tt.podSets {
+			advDeploy.Status.PodSets["app-"+cell] = podSet
+		}
+		if tt.aborted != "" {
+			advDeploy.Status.AbortedRollouts = []workloadv1beta1.AbortedRollout{{Deployment: "app-" + tt.aborted}}
+		}
+
+		if got := Weights(advDeploy); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: expected %v got %v", tt.name, tt.expected, got)
+		}
+	}
+}
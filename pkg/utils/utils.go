@@ -1,26 +1,17 @@
 package utils
 
 import (
-	"fmt"
 	"k8s.io/apimachinery/pkg/util/intstr"
-	"strings"
+	"sort"
 )
 
+// ObservedNamespace are the namespaces the AdvDeployments are reconciled in
 var ObservedNamespace = []string{
 	"default",
 	"dmall-inner",
 	"dmall-outer",
 }
 
-const (
-	ObserveMustLabelClusterName      = "sym-cluster-info"
-	ObserveMustLabelAppName          = "app"
-	ObserveMustLabelReleaseName      = "release"
-	ObserveMustLabelLdcName          = "sym-ldc"
-	ObserveMustLabelLightningDomain0 = "lightningDomain0"
-	ObserveMustLabelGroupName        = "sym-group"
-)
-
 func StrPointer(s string) *string {
 	return &s
 }
@@ -115,16 +106,44 @@ func RemoveString(slice []string, s string) (result []string) {
 	return
 }
 
-// SplitMetaLdcGroupKey returns ldc name and group name
-func SplitMetaLdcGroupKey(key string) (ldcName, groupName string, err error) {
-	parts := strings.Split(key, "-")
-	switch len(parts) {
-	case 1:
-		// ldc only, no group
-		return parts[0], "", nil
-	case 2:
-		return parts[0], parts[1], nil
+// Distribute spreads total across len(weights) parts proportionally to weights,
+// using the largest remainder so that the parts add up to total. Without any
+// weight total is spread evenly.
+func Distribute(total int32, weights []int32) []int32 {
+	parts := make([]int32, len(weights))
+	if len(weights) == 0 {
+		return parts
+	}
+
+	shares := make([]int64, len(weights))
+	var sum int64
+	for i, w := range weights {
+		if w > 0 {
+			shares[i] = int64(w)
+			sum += int64(w)
+		}
+	}
+	if sum == 0 {
+		for i := range shares {
+			shares[i] = 1
+		}
+		sum = int64(len(shares))
+	}
+
+	order := make([]int, len(shares))
+	var assigned int32
+	for i, share := range shares {
+		order[i] = i
+		parts[i] = int32(share * int64(total) / sum)
+		assigned += parts[i]
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return shares[order[a]]*int64(total)%sum > shares[order[b]]*int64(total)%sum
+	})
+	for i := 0; assigned < total; i++ {
+		parts[order[i]]++
+		assigned++
 	}
 
-	return "", "", fmt.Errorf("unexpected key format: %q", key)
+	return parts
 }
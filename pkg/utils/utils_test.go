@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDistribute(t *testing.T) {
+	tests := []struct {
+		total    int32
+		weights  []int32
+		expected []int32
+	}{
+		{total: 10, weights: []int32{1, 1}, expected: []int32{5, 5}},
+		{total: 7, weights: []int32{2, 1}, expected: []int32{5, 2}},
+		{total: 100, weights: []int32{1, 1, 1}, expected: []int32{34, 33, 33}},
+		{total: 3, weights: []int32{0, 0}, expected: []int32{2, 1}},
+		{total: 0, weights: []int32{3, 1}, expected: []int32{0, 0}},
+		{total: 5, weights: nil, expected: []int32{}},
+	}
+
+	for _, tt := range tests {
+		if got := Distribute(tt.total, tt.weights); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Distribute(%d, %v): expected %v got %v", tt.total, tt.weights, tt.expected, got)
+		}
+	}
+}